@@ -0,0 +1,519 @@
+package serialport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy selects what happens when a buffer of an AsyncReader
+// is full.
+type OverflowPolicy int
+
+const (
+	OverflowDropOldest OverflowPolicy = iota // отбросить самые старые данные
+	OverflowBlock                            // остановить чтение транспорта до освобождения места
+	OverflowError                            // завершить с ErrOverflow
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowBlock:
+		return "block"
+	case OverflowError:
+		return "error"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// ErrOverflow is returned when a buffer overflows with OverflowError.
+var ErrOverflow = errors.New("buffer overflow")
+
+// asyncMaxPending limits an incomplete frame of a subscription when the
+// reader has no ring buffer.
+const asyncMaxPending = 64 << 10
+
+// ErrNoBuffer is returned by Read of an AsyncReader without a buffer.
+var ErrNoBuffer = errors.New("async reader without buffer")
+
+// ring is a bounded byte FIFO.
+type ring struct {
+	buf  []byte
+	r, n int
+}
+
+func (q *ring) free() int { return len(q.buf) - q.n }
+
+// write appends as much of p as fits and returns the count.
+func (q *ring) write(p []byte) int {
+	written := 0
+	for len(p) > 0 && q.n < len(q.buf) {
+		w := (q.r + q.n) % len(q.buf)
+		end := len(q.buf)
+		if w < q.r {
+			end = q.r
+		}
+		c := copy(q.buf[w:end], p)
+		q.n += c
+		p = p[c:]
+		written += c
+	}
+	return written
+}
+
+func (q *ring) read(p []byte) int {
+	read := 0
+	for len(p) > 0 && q.n > 0 {
+		end := q.r + q.n
+		if end > len(q.buf) {
+			end = len(q.buf)
+		}
+		c := copy(p, q.buf[q.r:end])
+		q.r = (q.r + c) % len(q.buf)
+		q.n -= c
+		p = p[c:]
+		read += c
+	}
+	return read
+}
+
+func (q *ring) discard(n int) {
+	if n > q.n {
+		n = q.n
+	}
+	q.r = (q.r + n) % len(q.buf)
+	q.n -= n
+}
+
+// AsyncReader drains a transport in the background. The data is kept in
+// a ring buffer for Read and delivered to subscriptions. Errors of the
+// transport other than ErrTimeout stop the reader.
+type AsyncReader struct {
+	r      ChannelI
+	wait   time.Duration
+	policy OverflowPolicy
+
+	mu      sync.Mutex
+	ring    ring
+	dropped int
+	err     error         // причина остановки
+	notify  chan struct{} // закрывается при изменении буфера
+	subs    []*Subscription
+	started bool
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewAsyncReader creates a reader of r with a ring buffer of size bytes
+// (0 - no buffer, subscriptions only). wait is the timeout of Read.
+// Start starts reading.
+func NewAsyncReader(r ChannelI, wait time.Duration, size int, policy OverflowPolicy) *AsyncReader {
+	a := &AsyncReader{
+		r:       r,
+		wait:    wait,
+		policy:  policy,
+		notify:  make(chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if size > 0 {
+		a.ring.buf = make([]byte, size)
+	}
+	return a
+}
+
+// Start starts the background reader.
+func (a *AsyncReader) Start() {
+	a.mu.Lock()
+	a.started = true
+	a.mu.Unlock()
+	go a.loop()
+}
+
+// wakeLocked wakes everybody waiting on notify, a.mu must be held.
+func (a *AsyncReader) wakeLocked() {
+	close(a.notify)
+	a.notify = make(chan struct{})
+}
+
+func (a *AsyncReader) loop() {
+	defer close(a.stopped)
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-a.done:
+			a.stop(net.ErrClosed)
+			return
+		default:
+		}
+		n, err := a.r.Read(buf, 0)
+		if n > 0 {
+			data := append([]byte(nil), buf[:n]...)
+			if perr := a.put(data); perr != nil {
+				a.stop(perr)
+				return
+			}
+			a.mu.Lock()
+			subs := append([]*Subscription(nil), a.subs...)
+			a.mu.Unlock()
+			for _, s := range subs {
+				s.feed(data, a.done)
+			}
+		}
+		if err != nil && !errors.Is(err, ErrTimeout) {
+			a.stop(err)
+			return
+		}
+	}
+}
+
+// put stores data into the ring buffer according to the policy.
+func (a *AsyncReader) put(data []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ring.buf == nil {
+		return nil
+	}
+	for len(data) > 0 {
+		if a.ring.free() < len(data) {
+			switch a.policy {
+			case OverflowDropOldest:
+				if len(data) > len(a.ring.buf) {
+					a.dropped += len(data) - len(a.ring.buf)
+					data = data[len(data)-len(a.ring.buf):]
+				}
+				drop := len(data) - a.ring.free()
+				a.ring.discard(drop)
+				a.dropped += drop
+			case OverflowError:
+				return ErrOverflow
+			}
+		}
+		n := a.ring.write(data)
+		data = data[n:]
+		if n > 0 {
+			a.wakeLocked()
+		}
+		if len(data) > 0 {
+			// OverflowBlock: ждем чтения
+			notify := a.notify
+			a.mu.Unlock()
+			select {
+			case <-notify:
+			case <-a.done:
+				a.mu.Lock()
+				return net.ErrClosed
+			}
+			a.mu.Lock()
+		}
+	}
+	return nil
+}
+
+func (a *AsyncReader) stop(err error) {
+	a.mu.Lock()
+	if a.err == nil {
+		a.err = err
+	}
+	subs := a.subs
+	a.subs = nil
+	a.wakeLocked()
+	a.mu.Unlock()
+	for _, s := range subs {
+		s.close(err)
+	}
+}
+
+// Read returns buffered data. It waits up to the read timeout for
+// estimated_byte bytes (any data if estimated_byte <= 0) and returns
+// ErrTimeout if there is none. After the reader stopped, the buffered
+// data is returned and then the error that stopped it.
+func (a *AsyncReader) Read(b []byte, estimated_byte int) (int, error) {
+	need := estimated_byte
+	if need <= 0 || need > len(b) {
+		need = 1
+	}
+	timer := time.NewTimer(a.wait)
+	defer timer.Stop()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ring.buf == nil {
+		return 0, ErrNoBuffer
+	}
+	for {
+		if a.ring.n >= need || (a.err != nil && a.ring.n > 0) {
+			n := a.ring.read(b)
+			a.wakeLocked()
+			return n, nil
+		}
+		if a.err != nil {
+			return 0, a.err
+		}
+		notify := a.notify
+		a.mu.Unlock()
+		select {
+		case <-notify:
+			a.mu.Lock()
+		case <-timer.C:
+			a.mu.Lock()
+			n := a.ring.read(b)
+			if n == 0 {
+				return 0, ErrTimeout
+			}
+			a.wakeLocked()
+			return n, nil
+		}
+	}
+}
+
+// Write writes to the transport, so that the reader can be used as a
+// ChannelI, e.g. with Slip.
+func (a *AsyncReader) Write(b []byte) (int, error) {
+	return a.r.Write(b)
+}
+
+// Buffered returns the number of bytes in the ring buffer.
+func (a *AsyncReader) Buffered() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.ring.n
+}
+
+// Dropped returns the number of bytes dropped from the ring buffer.
+func (a *AsyncReader) Dropped() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
+
+// Err returns the error that stopped the reader.
+func (a *AsyncReader) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Close stops the reader and closes the subscriptions. It waits for the
+// pending Read of the transport, the transport itself is not closed.
+func (a *AsyncReader) Close() error {
+	a.once.Do(func() { close(a.done) })
+	a.mu.Lock()
+	started := a.started
+	a.mu.Unlock()
+	if started {
+		<-a.stopped
+	} else {
+		a.stop(net.ErrClosed)
+	}
+	return nil
+}
+
+// Subscribe returns a subscription delivering the received chunks on a
+// channel of n entries.
+func (a *AsyncReader) Subscribe(n int) *Subscription {
+	return a.subscribe(n, nil)
+}
+
+// SubscribeFrames returns a subscription delivering frames split from
+// the received data by split, e.g. SlipSplit. An incomplete frame is
+// limited to the ring buffer size (64 KiB without a buffer); on overflow
+// its stale prefix is dropped, or the subscription is closed with
+// ErrOverflow under OverflowError.
+func (a *AsyncReader) SubscribeFrames(n int, split bufio.SplitFunc) *Subscription {
+	return a.subscribe(n, split)
+}
+
+func (a *AsyncReader) subscribe(n int, split bufio.SplitFunc) *Subscription {
+	ch := make(chan []byte, n)
+	s := &Subscription{C: ch, a: a, ch: ch, split: split, policy: a.policy, limit: len(a.ring.buf), done: make(chan struct{})}
+	if s.limit == 0 {
+		s.limit = asyncMaxPending
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		s.closed = true
+		s.err = a.err
+		close(ch)
+		close(s.done)
+		return s
+	}
+	a.subs = append(a.subs, s)
+	return s
+}
+
+// Subscription delivers data of an AsyncReader on C. C is closed when
+// the subscription or the reader is closed, see Err.
+type Subscription struct {
+	C <-chan []byte
+
+	a       *AsyncReader
+	ch      chan []byte
+	split   bufio.SplitFunc
+	policy  OverflowPolicy
+	pending []byte // данные неполного кадра
+	limit   int    // предельная длина pending
+	done    chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	closed  bool
+	err     error
+	dropped int
+}
+
+func (s *Subscription) feed(data []byte, stop <-chan struct{}) {
+	if s.split == nil {
+		s.send(data, stop)
+		return
+	}
+	s.pending = append(s.pending, data...)
+	for len(s.pending) > 0 {
+		adv, token, err := s.split(s.pending, false)
+		if err != nil {
+			s.close(err)
+			return
+		}
+		if adv == 0 && token == nil {
+			break
+		}
+		s.pending = s.pending[adv:]
+		if token != nil {
+			s.send(append([]byte(nil), token...), stop)
+		}
+	}
+	if len(s.pending) > s.limit {
+		// граница кадра так и не найдена: шум или неверный разделитель
+		if s.policy == OverflowError {
+			s.close(ErrOverflow)
+			return
+		}
+		s.pending = append([]byte(nil), s.pending[len(s.pending)-s.limit:]...)
+		s.mu.Lock()
+		s.dropped++
+		s.mu.Unlock()
+	}
+}
+
+func (s *Subscription) send(data []byte, stop <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.policy {
+	case OverflowBlock:
+		select {
+		case s.ch <- data:
+		case <-s.done:
+		case <-stop:
+		}
+		return
+	case OverflowError:
+		select {
+		case s.ch <- data:
+		default:
+			s.closeLocked(ErrOverflow)
+		}
+		return
+	}
+	for {
+		select {
+		case s.ch <- data:
+			return
+		default:
+		}
+		select {
+		case <-s.ch:
+			s.dropped++
+		default:
+		}
+	}
+}
+
+func (s *Subscription) close(err error) {
+	s.once.Do(func() { close(s.done) })
+	s.mu.Lock()
+	s.closeLocked(err)
+	s.mu.Unlock()
+}
+
+func (s *Subscription) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	s.once.Do(func() { close(s.done) })
+	close(s.ch)
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.a.mu.Lock()
+	for i, x := range s.a.subs {
+		if x == s {
+			s.a.subs = append(s.a.subs[:i], s.a.subs[i+1:]...)
+			break
+		}
+	}
+	s.a.mu.Unlock()
+	s.close(nil)
+}
+
+// Err returns the reason C was closed: nil after Close, ErrOverflow,
+// or the error that stopped the reader.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Dropped returns the number of entries dropped with OverflowDropOldest
+// and of incomplete frames cut to the limit.
+func (s *Subscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// SlipSplit is a bufio.SplitFunc returning decoded SLIP frames. Frames
+// shorter than 2 bytes (e.g. the flush byte before END) and frames with
+// a bad escape sequence are skipped.
+func SlipSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, c := range data {
+		if c != COD_END {
+			continue
+		}
+		frame := make([]byte, 0, i)
+		esc := false
+		for _, c := range data[:i] {
+			switch {
+			case esc && c == ESC_END:
+				frame = append(frame, COD_END)
+			case esc && c == ESC_ESC:
+				frame = append(frame, COD_ESC)
+			case esc:
+				// неизвестная ESC-последовательность, кадр отбрасывается
+				return i + 1, nil, nil
+			case c == COD_ESC:
+				esc = true
+				continue
+			default:
+				frame = append(frame, c)
+			}
+			esc = false
+		}
+		if len(frame) < 2 {
+			return i + 1, nil, nil
+		}
+		return i + 1, frame, nil
+	}
+	return 0, nil, nil
+}
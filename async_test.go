@@ -0,0 +1,200 @@
+package serialport
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// chanSource - транспорт, отдающий куски из канала
+func chanSource(in chan []byte) *MockSlip {
+	return &MockSlip{
+		MockRead: func(b []byte, e int) (int, error) {
+			select {
+			case data, ok := <-in:
+				if !ok {
+					return 0, syscall.EIO
+				}
+				return copy(b, data), nil
+			case <-time.After(5 * time.Millisecond):
+				return 0, ErrTimeout
+			}
+		},
+		MockWrite: func(b []byte) (int, error) { return len(b), nil },
+	}
+}
+
+func TestRing(t *testing.T) {
+	q := ring{buf: make([]byte, 5)}
+	q.write([]byte{1, 2, 3})
+	out := make([]byte, 2)
+	q.read(out)
+	if n := q.write([]byte{4, 5, 6, 7, 8}); n != 4 || q.free() != 0 {
+		t.Fatalf("write %d free %d", n, q.free())
+	}
+	out = make([]byte, 8)
+	if n := q.read(out); !bytes.Equal(out[:n], []byte{3, 4, 5, 6, 7}) {
+		t.Errorf("read %X", out[:n])
+	}
+}
+
+func TestAsyncReader(t *testing.T) {
+	in := make(chan []byte)
+	a := NewAsyncReader(chanSource(in), 100*time.Millisecond, 64, OverflowDropOldest)
+	raw := a.Subscribe(8)
+	frames := a.SubscribeFrames(8, SlipSplit)
+	a.Start()
+	defer a.Close()
+
+	in <- []byte{COD_FLUSH, COD_END, 1, COD_ESC}
+	in <- []byte{ESC_END, 2, COD_END, 3}
+	in <- []byte{4, COD_END}
+
+	for _, want := range [][]byte{{1, COD_END, 2}, {3, 4}} {
+		select {
+		case f := <-frames.C:
+			if !bytes.Equal(f, want) {
+				t.Errorf("кадр %X, ожидался %X", f, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("нет кадра")
+		}
+	}
+	if c := <-raw.C; !bytes.Equal(c, []byte{COD_FLUSH, COD_END, 1, COD_ESC}) {
+		t.Errorf("кусок %X", c)
+	}
+	buf := make([]byte, 64)
+	n, err := a.Read(buf, 10)
+	if err != nil || n != 10 {
+		t.Errorf("read %d %v", n, err)
+	}
+	if _, err := a.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+
+	raw.Close()
+	for range raw.C {
+	}
+	if raw.Err() != nil {
+		t.Errorf("raw err %v", raw.Err())
+	}
+
+	a.Close()
+	for range frames.C {
+	}
+	if !errors.Is(frames.Err(), net.ErrClosed) || !errors.Is(a.Err(), net.ErrClosed) {
+		t.Errorf("err %v %v", frames.Err(), a.Err())
+	}
+}
+
+func TestAsyncReaderOverflow(t *testing.T) {
+	in := make(chan []byte)
+	a := NewAsyncReader(chanSource(in), 20*time.Millisecond, 4, OverflowDropOldest)
+	sub := a.Subscribe(1)
+	a.Start()
+	in <- []byte{1, 2, 3}
+	in <- []byte{4, 5, 6}
+	in <- []byte{7}
+	a.Close()
+	buf := make([]byte, 8)
+	if n, _ := a.Read(buf, 0); !bytes.Equal(buf[:n], []byte{4, 5, 6, 7}) || a.Dropped() != 3 {
+		t.Errorf("read %X dropped %d", buf[:n], a.Dropped())
+	}
+	if sub.Dropped() != 2 {
+		t.Errorf("подписка: отброшено %d", sub.Dropped())
+	}
+
+	in = make(chan []byte)
+	a = NewAsyncReader(chanSource(in), 20*time.Millisecond, 4, OverflowError)
+	a.Start()
+	in <- []byte{1, 2, 3}
+	in <- []byte{4, 5}
+	close(in)
+	time.Sleep(20 * time.Millisecond)
+	if n, err := a.Read(buf, 0); err != nil || !bytes.Equal(buf[:n], []byte{1, 2, 3}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	if _, err := a.Read(buf, 0); err != ErrOverflow {
+		t.Errorf("ожидается ErrOverflow, получено %v", err)
+	}
+	a.Close()
+
+	in = make(chan []byte, 4)
+	a = NewAsyncReader(chanSource(in), 50*time.Millisecond, 4, OverflowBlock)
+	a.Start()
+	in <- []byte{1, 2, 3}
+	in <- []byte{4, 5, 6}
+	time.Sleep(20 * time.Millisecond)
+	if a.Buffered() != 4 {
+		t.Errorf("в буфере %d", a.Buffered())
+	}
+	got := []byte{}
+	for len(got) < 6 {
+		n, err := a.Read(buf[:2], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if !bytes.Equal(got, []byte{1, 2, 3, 4, 5, 6}) || a.Dropped() != 0 {
+		t.Errorf("read %X", got)
+	}
+	close(in)
+	a.Close()
+	if !errors.Is(a.Err(), syscall.EIO) && !errors.Is(a.Err(), net.ErrClosed) {
+		t.Errorf("err %v", a.Err())
+	}
+}
+
+func TestAsyncReaderSourceError(t *testing.T) {
+	in := make(chan []byte)
+	a := NewAsyncReader(chanSource(in), 20*time.Millisecond, 0, OverflowBlock)
+	sub := a.Subscribe(1)
+	a.Start()
+	close(in)
+	for range sub.C {
+	}
+	if !errors.Is(sub.Err(), syscall.EIO) {
+		t.Errorf("err %v", sub.Err())
+	}
+	if _, err := a.Read(make([]byte, 1), 0); err != ErrNoBuffer {
+		t.Errorf("err %v", err)
+	}
+	a.Close()
+	if late := a.Subscribe(1); late.Err() == nil {
+		t.Error("подписка на остановленный reader")
+	}
+}
+
+func TestSubscriptionPendingLimit(t *testing.T) {
+	in := make(chan []byte)
+	a := NewAsyncReader(chanSource(in), 20*time.Millisecond, 4, OverflowDropOldest)
+	sub := a.SubscribeFrames(1, SlipSplit)
+	a.Start()
+	in <- []byte{1, 2, 3}
+	in <- []byte{4, 5, 6}
+	in <- []byte{7, 8, COD_END}
+	frame := <-sub.C
+	a.Close()
+	if !bytes.Equal(frame, []byte{3, 4, 5, 6, 7, 8}) || sub.Dropped() != 1 {
+		t.Errorf("кадр %X, отброшено %d", frame, sub.Dropped())
+	}
+
+	in = make(chan []byte)
+	a = NewAsyncReader(chanSource(in), 20*time.Millisecond, 0, OverflowError)
+	sub = a.SubscribeFrames(1, SlipSplit)
+	a.Start()
+	noise := make([]byte, 4096)
+	for i := 0; i <= asyncMaxPending/len(noise); i++ {
+		in <- noise
+	}
+	for range sub.C {
+	}
+	if sub.Err() != ErrOverflow {
+		t.Errorf("ожидается ErrOverflow, получено %v", sub.Err())
+	}
+	a.Close()
+}
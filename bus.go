@@ -0,0 +1,149 @@
+package serialport
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Priority of a transaction waiting for the bus.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// busMaxSkips is how many times a waiter may be passed over by waiters
+// of higher priority before it gets the bus next (aging).
+const busMaxSkips = 8
+
+// busLock is a mutex granted by priority, equal priorities in the order
+// of arrival. A waiter passed over busMaxSkips times is served first,
+// so a stream of high priority calls does not starve the others.
+type busLock struct {
+	mu    sync.Mutex
+	held  bool
+	queue []*busWaiter // в порядке прихода
+}
+
+type busWaiter struct {
+	prio    Priority
+	skipped int           // сколько раз шину отдали более позднему ожидающему
+	ready   chan struct{} // закрывается при передаче шины
+}
+
+func (l *busLock) lock(ctx context.Context, prio Priority) error {
+	l.mu.Lock()
+	if !l.held {
+		l.held = true
+		l.mu.Unlock()
+		return nil
+	}
+	w := &busWaiter{prio: prio, ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-w.ready:
+		// шина уже передана, вернем ее следующему
+		l.release()
+	default:
+		for i := range l.queue {
+			if l.queue[i] == w {
+				l.queue = append(l.queue[:i], l.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+func (l *busLock) unlock() {
+	l.mu.Lock()
+	l.release()
+	l.mu.Unlock()
+}
+
+// release passes the bus to the next waiter, l.mu must be held.
+func (l *busLock) release() {
+	if len(l.queue) == 0 {
+		l.held = false
+		return
+	}
+	next := 0
+	for i, w := range l.queue {
+		if w.skipped >= busMaxSkips {
+			// самый старый из заждавшихся
+			next = i
+			break
+		}
+		if w.prio > l.queue[next].prio {
+			next = i
+		}
+	}
+	w := l.queue[next]
+	for _, o := range l.queue[:next] {
+		o.skipped++
+	}
+	l.queue = append(l.queue[:next], l.queue[next+1:]...)
+	close(w.ready)
+}
+
+// Tx is the bus held by a transaction. It is valid only inside the
+// transaction function.
+type Tx struct {
+	s   *SerialPort
+	ctx context.Context
+}
+
+// Context returns the context of the transaction.
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+func (tx *Tx) Write(b []byte) (int, error) {
+	return tx.s.writeTx(b)
+}
+
+func (tx *Tx) Read(b []byte, estimated_byte int) (int, error) {
+	return tx.s.readTx(b, estimated_byte)
+}
+
+// WriteToPeer is SerialPort.WriteToPeer inside the transaction.
+func (tx *Tx) WriteToPeer(b []byte, addr *net.UDPAddr) (int, error) {
+	return tx.s.writeToPeer(b, addr)
+}
+
+// LastPeer is SerialPort.LastPeer inside the transaction.
+func (tx *Tx) LastPeer() *net.UDPAddr {
+	return tx.s.udp_last_peer
+}
+
+// Transaction runs fn holding the bus exclusively, so that the exchange
+// is not interleaved with calls of other goroutines. Waiting transactions
+// get the bus by priority, equal priorities in the order of arrival; a
+// transaction passed over by higher priorities several times is served
+// next.
+// If ctx is done before the bus is free, its error is returned and fn is
+// not called. fn must use tx and not the methods of s.
+func (s *SerialPort) Transaction(ctx context.Context, prio Priority, fn func(tx *Tx) error) error {
+	if err := s.bus.lock(ctx, prio); err != nil {
+		return err
+	}
+	defer s.bus.unlock()
+	return fn(&Tx{s: s, ctx: ctx})
+}
+
+// acquire holds the bus for a single call.
+func (s *SerialPort) acquire() {
+	s.bus.lock(context.Background(), PriorityNormal)
+}
@@ -0,0 +1,177 @@
+package serialport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBusLockOrder(t *testing.T) {
+	var l busLock
+	l.lock(context.Background(), PriorityNormal)
+
+	var mu sync.Mutex
+	order := []string{}
+	var wg sync.WaitGroup
+	waiting := 0
+	start := func(name string, prio Priority) {
+		waiting++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.lock(context.Background(), prio)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			l.unlock()
+		}()
+		// дождемся постановки в очередь
+		for {
+			l.mu.Lock()
+			n := len(l.queue)
+			l.mu.Unlock()
+			if n == waiting {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	start("low", PriorityLow)
+	start("n1", PriorityNormal)
+	start("high", PriorityHigh)
+	start("n2", PriorityNormal)
+	l.unlock()
+	wg.Wait()
+	if want := []string{"high", "n1", "n2", "low"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("порядок %v, ожидался %v", order, want)
+	}
+	if l.held || len(l.queue) != 0 {
+		t.Error("шина не освобождена")
+	}
+}
+
+func TestBusLockAging(t *testing.T) {
+	var l busLock
+	l.held = true
+	low := &busWaiter{prio: PriorityLow, ready: make(chan struct{})}
+	l.queue = []*busWaiter{low}
+	// поток вызовов высокого приоритета
+	for i := 0; i <= busMaxSkips; i++ {
+		l.queue = append(l.queue, &busWaiter{prio: PriorityHigh, ready: make(chan struct{})})
+		l.unlock()
+		select {
+		case <-low.ready:
+			if i != busMaxSkips {
+				t.Errorf("низкий приоритет получил шину на %d шаге", i)
+			}
+			return
+		default:
+		}
+	}
+	t.Error("низкий приоритет не получил шину")
+}
+
+func TestBusLockContext(t *testing.T) {
+	var l busLock
+	l.lock(context.Background(), PriorityNormal)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.lock(ctx, PriorityHigh); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err %v", err)
+	}
+	if len(l.queue) != 0 {
+		t.Error("отмененный ожидающий остался в очереди")
+	}
+	l.unlock()
+	if err := l.lock(context.Background(), PriorityNormal); err != nil || !l.held {
+		t.Errorf("шина не захвачена: %v", err)
+	}
+}
+
+func TestSerialPortTransaction(t *testing.T) {
+	master, err := NewSerialPortPty(200 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	// устройство: отвечает на запрос [addr] ответом [addr addr]
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := slave.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, a := range buf[:n] {
+				time.Sleep(time.Millisecond)
+				slave.Write([]byte{a, a})
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for dev := byte(1); dev <= 4; dev++ {
+		wg.Add(1)
+		go func(dev byte) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				err := master.Transaction(context.Background(), PriorityNormal, func(tx *Tx) error {
+					if _, err := tx.Write([]byte{dev}); err != nil {
+						return err
+					}
+					buf := make([]byte, 8)
+					got := 0
+					for got < 2 {
+						n, err := tx.Read(buf[got:], 2-got)
+						if err != nil {
+							return err
+						}
+						got += n
+					}
+					if !bytes.Equal(buf[:got], []byte{dev, dev}) {
+						return fmt.Errorf("устройство %d: чужой ответ %X", dev, buf[:got])
+					}
+					return nil
+				})
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(dev)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	hold := make(chan struct{})
+	go master.Transaction(context.Background(), PriorityNormal, func(tx *Tx) error {
+		close(hold)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	<-hold
+	called := false
+	err = master.Transaction(ctx, PriorityHigh, func(tx *Tx) error { called = true; return nil })
+	if !errors.Is(err, context.DeadlineExceeded) || called {
+		t.Errorf("err %v, called %v", err, called)
+	}
+}
@@ -0,0 +1,130 @@
+// Command ser2net shares local serial ports over TCP.
+//
+// Usage:
+//
+//	ser2net -config ser2net.json
+//
+// Config file:
+//
+//	{
+//	  "ports": [
+//	    {
+//	      "listen": ":4001",
+//	      "url": "serial:///dev/ttyUSB0?baud=9600&parity=E&timeout=100ms",
+//	      "policy": "one-writer",
+//	      "idle_timeout": "10m",
+//	      "allow": ["10.0.0.0/8", "192.168.1.15"]
+//	    }
+//	  ]
+//	}
+//
+// policy is one of shared, one-writer, takeover, exclusive.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lasaleks/serialport"
+)
+
+type portConfig struct {
+	Listen      string   `json:"listen"`
+	URL         string   `json:"url"`
+	Policy      string   `json:"policy"`
+	IdleTimeout string   `json:"idle_timeout"`
+	Allow       []string `json:"allow"`
+}
+
+type config struct {
+	Ports []portConfig `json:"ports"`
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(c.Ports) == 0 {
+		return nil, fmt.Errorf("%s: no ports", path)
+	}
+	return &c, nil
+}
+
+func newServer(pc portConfig) (*serialport.TcpServer, serialport.InterfaceSerial, error) {
+	var cfg serialport.ServerConfig
+	var err error
+	if pc.Policy != "" {
+		if cfg.Policy, err = serialport.ParseServerPolicy(pc.Policy); err != nil {
+			return nil, nil, err
+		}
+	}
+	if pc.IdleTimeout != "" {
+		if cfg.IdleTimeout, err = time.ParseDuration(pc.IdleTimeout); err != nil {
+			return nil, nil, fmt.Errorf("idle_timeout: %w", err)
+		}
+	}
+	cfg.Allow = pc.Allow
+	port, err := serialport.Open(pc.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", pc.URL, err)
+	}
+	srv, err := serialport.NewTcpServer(port, cfg)
+	if err != nil {
+		port.Close()
+		return nil, nil, err
+	}
+	return srv, port, nil
+}
+
+func main() {
+	configPath := flag.String("config", "ser2net.json", "config file")
+	flag.Parse()
+
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	servers := []*serialport.TcpServer{}
+	ports := []serialport.InterfaceSerial{}
+	for _, pc := range c.Ports {
+		srv, port, err := newServer(pc)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, srv)
+		ports = append(ports, port)
+		wg.Add(1)
+		go func(pc portConfig) {
+			defer wg.Done()
+			log.Printf("%s -> %s", pc.Listen, pc.URL)
+			if err := srv.ListenAndServe(pc.Listen); err != serialport.ErrServerClosed {
+				log.Printf("%s: %s", pc.Listen, err)
+			}
+		}(pc)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	for _, srv := range servers {
+		srv.Close()
+	}
+	wg.Wait()
+	for _, port := range ports {
+		port.Close()
+	}
+}
@@ -0,0 +1,68 @@
+package serialport
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// modemLineSetter sets TIOCM_* modem lines, implemented by Port.
+type modemLineSetter interface {
+	setModemLine(line int, on bool) error
+}
+
+// CtrlModemLines drives the RS-485 driver enable of adapters that wire
+// it to RTS and/or DTR. SerialPort binds it to the port on Connect.
+// TxEn(true) asserts the lines, TxEn(false) releases them; the delays
+// around the data are set by SerialPort.SetTurnaround. RxEn does
+// nothing: the receiver follows the same line.
+type CtrlModemLines struct {
+	port      modemLineSetter
+	lines     int // TIOCM_RTS | TIOCM_DTR
+	activeLow bool
+}
+
+// ErrModemLine is returned when neither RTS nor DTR is selected.
+var ErrModemLine = errors.New("no modem line selected")
+
+// NewCtrlModemLines creates a control of RTS and/or DTR. With activeLow
+// the driver is enabled by the line being off.
+func NewCtrlModemLines(rts, dtr, activeLow bool) (*CtrlModemLines, error) {
+	c := &CtrlModemLines{activeLow: activeLow}
+	if rts {
+		c.lines |= unix.TIOCM_RTS
+	}
+	if dtr {
+		c.lines |= unix.TIOCM_DTR
+	}
+	if c.lines == 0 {
+		return nil, &ConfigError{Field: "lines", Value: "none", Err: ErrModemLine}
+	}
+	return c, nil
+}
+
+// SetPort binds the control to p and switches to receive.
+func (c *CtrlModemLines) SetPort(p *Port) error {
+	return c.bind(p)
+}
+
+func (c *CtrlModemLines) bind(p modemLineSetter) error {
+	c.port = p
+	return c.set(false)
+}
+
+func (c *CtrlModemLines) set(tx bool) error {
+	if c.port == nil {
+		return os.ErrClosed
+	}
+	return c.port.setModemLine(c.lines, tx != c.activeLow)
+}
+
+func (c *CtrlModemLines) TxEn(value bool) error {
+	return c.set(value)
+}
+
+func (c *CtrlModemLines) RxEn(value bool) error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package serialport
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+type fakeModemLines struct {
+	lines int
+	calls int
+}
+
+func (f *fakeModemLines) setModemLine(line int, on bool) error {
+	f.calls++
+	if on {
+		f.lines |= line
+	} else {
+		f.lines &^= line
+	}
+	return nil
+}
+
+func TestCtrlModemLines(t *testing.T) {
+	if _, err := NewCtrlModemLines(false, false, false); !errors.Is(err, ErrModemLine) {
+		t.Fatal("ожидалась ошибка без линий:", err)
+	}
+	c, err := NewCtrlModemLines(true, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TxEn(true); !errors.Is(err, os.ErrClosed) {
+		t.Fatal("ожидалась ошибка без порта:", err)
+	}
+	f := &fakeModemLines{lines: unix.TIOCM_RTS | unix.TIOCM_DTR}
+	c.bind(f)
+	if f.lines != unix.TIOCM_DTR {
+		t.Fatalf("после привязки RTS должен быть снят: %#x", f.lines)
+	}
+	c.TxEn(true)
+	c.RxEn(true)
+	if f.lines != unix.TIOCM_RTS|unix.TIOCM_DTR {
+		t.Fatalf("передача: %#x", f.lines)
+	}
+	c.TxEn(false)
+	c.RxEn(false)
+	if f.lines != unix.TIOCM_DTR {
+		t.Fatalf("прием: %#x", f.lines)
+	}
+
+	// инверсия, обе линии
+	c, _ = NewCtrlModemLines(true, true, true)
+	f = &fakeModemLines{}
+	c.bind(f)
+	if f.lines != unix.TIOCM_RTS|unix.TIOCM_DTR {
+		t.Fatalf("прием с инверсией: %#x", f.lines)
+	}
+	c.TxEn(true)
+	if f.lines != 0 {
+		t.Fatalf("передача с инверсией: %#x", f.lines)
+	}
+}
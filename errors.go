@@ -0,0 +1,67 @@
+package serialport
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TimeoutError is the type of ErrTimeout. It implements net.Error.
+type TimeoutError struct{}
+
+func (TimeoutError) Error() string   { return "timeout" }
+func (TimeoutError) Timeout() bool   { return true }
+func (TimeoutError) Temporary() bool { return true }
+
+// ErrDisconnected matches every DisconnectError with errors.Is.
+var ErrDisconnected = errors.New("disconnected")
+
+// DisconnectError reports that the device or the connection is gone:
+// USB unplug, hangup, closed connection.
+type DisconnectError struct {
+	Port string
+	Err  error // исходная ошибка: EIO, ENXIO, EOF...
+}
+
+func (e *DisconnectError) Error() string {
+	return fmt.Sprintf("%s: disconnected: %s", e.Port, e.Err)
+}
+
+func (e *DisconnectError) Unwrap() error { return e.Err }
+
+func (e *DisconnectError) Is(target error) bool { return target == ErrDisconnected }
+
+// ErrBadBaud is returned if the baud rate is not supported.
+var ErrBadBaud = errors.New("unrecognized baud rate")
+
+// ErrBadFlowControl is returned if the flow control is not supported.
+var ErrBadFlowControl = errors.New("unsupported flow control")
+
+// ErrBadTransport is returned by SerialPort of an unknown transport type.
+var ErrBadTransport = errors.New("unknown transport type")
+
+// ConfigError reports a bad setting. Err is one of the ErrBad* errors.
+type ConfigError struct {
+	Field string // имя поля Config: Baud, Size, Parity, StopBits...
+	Value any
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s %v: %s", e.Field, e.Value, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// SlipError reports a SLIP encoding or decoding error. Err is
+// ErrBufferOverflow or ErrUnknownEscapedByte.
+type SlipError struct {
+	Err  error
+	Pos  int  // позиция в кадре
+	Byte byte // байт, вызвавший ошибку
+}
+
+func (e *SlipError) Error() string {
+	return fmt.Sprintf("slip: %s at %d (0x%02X)", e.Err, e.Pos, e.Byte)
+}
+
+func (e *SlipError) Unwrap() error { return e.Err }
@@ -0,0 +1,78 @@
+package serialport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestErrTimeout(t *testing.T) {
+	var ne net.Error
+	if !errors.As(ErrTimeout, &ne) || !ne.Timeout() {
+		t.Error("ErrTimeout не реализует net.Error")
+	}
+	var te TimeoutError
+	if !errors.As(ErrTimeout, &te) {
+		t.Error("errors.As TimeoutError")
+	}
+}
+
+func TestDisconnectError(t *testing.T) {
+	err := error(&DisconnectError{Port: "/dev/ttyUSB0", Err: syscall.EIO})
+	if !errors.Is(err, ErrDisconnected) || !errors.Is(err, syscall.EIO) {
+		t.Errorf("errors.Is %v", err)
+	}
+	if ClassifyError(&DisconnectError{Port: "x", Err: io.EOF}) != ErrorDisconnect {
+		t.Error("ClassifyError")
+	}
+	p := &Port{}
+	if p.ioErr(nil) != nil {
+		t.Error("ioErr(nil)")
+	}
+}
+
+func TestConfigError(t *testing.T) {
+	_, err := OpenPort(&Config{Name: "/dev/null", Baud: 12345})
+	var ce *ConfigError
+	if !errors.As(err, &ce) || ce.Field != "Baud" || ce.Value != 12345 || !errors.Is(err, ErrBadBaud) {
+		t.Errorf("err %v", err)
+	}
+	_, err = OpenPort(&Config{Name: "/dev/null", Baud: 9600, Size: 9})
+	if !errors.As(err, &ce) || ce.Field != "Size" || !errors.Is(err, ErrBadSize) {
+		t.Errorf("err %v", err)
+	}
+	if _, err := ParseParity("X"); !errors.Is(err, ErrBadParity) {
+		t.Errorf("err %v", err)
+	}
+	var s SerialPort
+	if _, err := s.Write([]byte{1}); !errors.Is(err, ErrBadTransport) {
+		t.Errorf("err %v", err)
+	}
+}
+
+func TestSlipError(t *testing.T) {
+	r := NewSlipReadByte(8, func(buf []byte, size int) {})
+	var se *SlipError
+	r.Readbyte(1)
+	r.Readbyte(COD_ESC)
+	err := r.Readbyte(0x05)
+	if !errors.As(err, &se) || se.Pos != 1 || se.Byte != 0x05 || !errors.Is(err, ErrUnknownEscapedByte) {
+		t.Errorf("err %v", err)
+	}
+
+	r = NewSlipReadByte(2, func(buf []byte, size int) {})
+	r.Readbyte(1)
+	r.Readbyte(2)
+	if err := r.Readbyte(3); !errors.As(err, &se) || se.Pos != 2 || !errors.Is(err, ErrBufferOverflow) {
+		t.Errorf("err %v", err)
+	}
+
+	big := make([]byte, BUF_SIZE)
+	big[10] = COD_END
+	mock := MockSlip{MockWrite: func(b []byte) (int, error) { return len(b), nil }}
+	if _, err := SlipWrite(&mock, big); !errors.As(err, &se) || !errors.Is(err, ErrBufferOverflow) {
+		t.Errorf("err %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package serialport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrIncompleteResponse is the error of an attempt that ended before
+// the response was complete.
+var ErrIncompleteResponse = errors.New("incomplete response")
+
+// Exchange is a request/response exchange, see SerialPort.Exchange.
+type Exchange struct {
+	Request []byte
+
+	// Expected is the response length. If 0, the response is complete
+	// when Complete returns true, or without Complete after the first Read.
+	Expected int
+	Complete func(resp []byte) bool
+
+	// Validate checks a complete response (address, CRC). An error makes
+	// the attempt fail and be retried.
+	Validate func(resp []byte) error
+
+	Retries    int           // повторов после первой попытки
+	Timeout    time.Duration // на попытку, ограничивает и каждое чтение; 0 - пока транспорт не вернет ErrTimeout
+	FlushInput bool          // отбросить принятые ранее данные перед отправкой
+	MaxLen     int           // размер буфера ответа, 256 по умолчанию
+	Priority   Priority
+}
+
+// ExchangeAttempt describes one attempt of an exchange.
+type ExchangeAttempt struct {
+	Start    time.Time
+	Duration time.Duration
+	Flushed  int // отброшено устаревших байт
+	Sent     int
+	Reads    int
+	Response []byte // принятые данные, в том числе неполные
+	Err      error
+}
+
+// ExchangeError is returned when all attempts failed. It unwraps to the
+// error of the last attempt.
+type ExchangeError struct {
+	Attempts []ExchangeAttempt
+}
+
+func (e *ExchangeError) Error() string {
+	last := e.Attempts[len(e.Attempts)-1]
+	return fmt.Sprintf("exchange failed after %d attempts: %s", len(e.Attempts), last.Err)
+}
+
+func (e *ExchangeError) Unwrap() error {
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// Exchange sends e.Request and reads the response holding the bus, see
+// Transaction. Timeouts, incomplete and invalid responses are retried
+// e.Retries times, other errors end the exchange. The attempts are
+// returned also on error.
+func (s *SerialPort) Exchange(ctx context.Context, e *Exchange) ([]byte, []ExchangeAttempt, error) {
+	var resp []byte
+	var attempts []ExchangeAttempt
+	err := s.Transaction(ctx, e.Priority, func(tx *Tx) error {
+		var err error
+		resp, attempts, err = tx.Exchange(e)
+		return err
+	})
+	return resp, attempts, err
+}
+
+// Exchange is SerialPort.Exchange inside the transaction.
+func (tx *Tx) Exchange(e *Exchange) ([]byte, []ExchangeAttempt, error) {
+	attempts := []ExchangeAttempt{}
+	for i := 0; i <= e.Retries; i++ {
+		if err := tx.ctx.Err(); err != nil {
+			return nil, attempts, err
+		}
+		a := tx.s.exchangeAttempt(tx.ctx, e)
+		attempts = append(attempts, a)
+		if a.Err == nil {
+			return a.Response, attempts, nil
+		}
+		if !errors.Is(a.Err, ErrTimeout) && !errors.Is(a.Err, ErrIncompleteResponse) && !errors.As(a.Err, new(*ValidationError)) {
+			break
+		}
+	}
+	return nil, attempts, &ExchangeError{Attempts: attempts}
+}
+
+// ValidationError is the error of an attempt rejected by Exchange.Validate.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return "invalid response: " + e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+func (e *Exchange) complete(resp []byte) bool {
+	switch {
+	case e.Expected > 0:
+		return len(resp) >= e.Expected
+	case e.Complete != nil:
+		return e.Complete(resp)
+	}
+	return len(resp) > 0
+}
+
+func (s *SerialPort) exchangeAttempt(ctx context.Context, e *Exchange) (a ExchangeAttempt) {
+	a.Start = time.Now()
+	defer func() { a.Duration = time.Since(a.Start) }()
+	actx := ctx
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	if e.FlushInput {
+		a.Flushed, a.Err = s.flushInput()
+		if a.Err != nil {
+			return
+		}
+	}
+	a.Sent, a.Err = s.writeTx(e.Request)
+	if a.Err != nil {
+		return
+	}
+	max := e.MaxLen
+	if max <= 0 {
+		max = 256
+	}
+	if e.Expected > max {
+		max = e.Expected
+	}
+	buf := make([]byte, max)
+	got := 0
+	for got < len(buf) {
+		estimated := 0
+		if e.Expected > 0 {
+			estimated = e.Expected - got
+		}
+		n, err := s.readContext(actx, buf[got:], estimated)
+		a.Reads++
+		got += n
+		switch {
+		case err != nil && ctx.Err() == nil && actx.Err() != nil:
+			// истек Timeout попытки
+			err = ErrTimeout
+		case err == nil && n == 0:
+			// пустая датаграмма и т.п., не ждем бесконечно
+			err = ErrTimeout
+		}
+		if err != nil {
+			if errors.Is(err, ErrTimeout) && got > 0 {
+				err = ErrIncompleteResponse
+			}
+			a.Response, a.Err = buf[:got], err
+			return
+		}
+		if e.complete(buf[:got]) {
+			break
+		}
+	}
+	a.Response = buf[:got]
+	if !e.complete(a.Response) {
+		a.Err = ErrIncompleteResponse
+		return
+	}
+	if e.Validate != nil {
+		if err := e.Validate(a.Response); err != nil {
+			a.Err = &ValidationError{Err: err}
+		}
+	}
+	return
+}
+
+// flushInput discards received data and returns the number of bytes
+// discarded.
+func (s *SerialPort) flushInput() (int, error) {
+	switch s.type_serial {
+	case type_serial_stty, type_serial_pty:
+		if s.stty == nil {
+			return 0, net.ErrClosed
+		}
+		n, _ := s.stty.InputQueued()
+		return n, s.stty.FlushInput()
+	case type_serial_udp:
+		if s.udp_con == nil {
+			return 0, net.ErrClosed
+		}
+		n := len(s.udp_pending)
+		s.udp_pending, s.udp_pending_addr = nil, nil
+		if s.udp_buf == nil {
+			s.udp_buf = make([]byte, 65536)
+		}
+		s.udp_con.SetReadDeadline(time.Now())
+		for {
+			m, _, err := s.udp_con.ReadFromUDP(s.udp_buf)
+			if err != nil {
+				break
+			}
+			n += m
+		}
+		return n, nil
+	}
+	return 0, &ConfigError{Field: "type_serial", Value: s.type_serial, Err: ErrBadTransport}
+}
@@ -0,0 +1,168 @@
+package serialport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExchange(t *testing.T) {
+	master, err := NewSerialPortPty(50 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	// ответы устройства на очередные запросы, nil - молчание
+	answers := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			if _, err := slave.Read(buf); err != nil {
+				return
+			}
+			if a := <-answers; a != nil {
+				slave.Write(a[:1])
+				time.Sleep(2 * time.Millisecond)
+				slave.Write(a[1:])
+			}
+		}
+	}()
+	checksum := func(resp []byte) error {
+		var sum byte
+		for _, c := range resp[:len(resp)-1] {
+			sum += c
+		}
+		if sum != resp[len(resp)-1] {
+			return errors.New("checksum")
+		}
+		return nil
+	}
+
+	// неверный ответ, затем верный
+	answers <- []byte{1, 2, 0}
+	answers <- []byte{1, 2, 3}
+	resp, attempts, err := master.Exchange(context.Background(), &Exchange{
+		Request: []byte{0x10}, Expected: 3, Validate: checksum, Retries: 2,
+	})
+	if err != nil || !bytes.Equal(resp, []byte{1, 2, 3}) {
+		t.Fatalf("resp %X %v", resp, err)
+	}
+	var ve *ValidationError
+	if len(attempts) != 2 || !errors.As(attempts[0].Err, &ve) || attempts[1].Reads < 1 || attempts[0].Sent != 1 {
+		t.Errorf("attempts %+v", attempts)
+	}
+
+	// устаревшие данные во входном буфере
+	slave.Write([]byte{0xEE, 0xEE})
+	time.Sleep(10 * time.Millisecond)
+	answers <- []byte{5, 6, 0x0B}
+	resp, attempts, err = master.Exchange(context.Background(), &Exchange{
+		Request: []byte{0x11}, FlushInput: true, Validate: checksum,
+		Complete: func(resp []byte) bool { return len(resp) >= 3 },
+	})
+	if err != nil || !bytes.Equal(resp, []byte{5, 6, 0x0B}) || attempts[0].Flushed != 2 {
+		t.Errorf("resp %X %v attempts %+v", resp, err, attempts)
+	}
+
+	// устройство молчит
+	answers <- nil
+	answers <- nil
+	_, attempts, err = master.Exchange(context.Background(), &Exchange{Request: []byte{0x12}, Expected: 3, Retries: 1})
+	var ee *ExchangeError
+	if !errors.As(err, &ee) || !errors.Is(err, ErrTimeout) || len(attempts) != 2 || len(ee.Attempts) != 2 {
+		t.Errorf("err %v attempts %+v", err, attempts)
+	}
+
+	// неполный ответ
+	answers <- []byte{7, 8}
+	_, attempts, err = master.Exchange(context.Background(), &Exchange{Request: []byte{0x13}, Expected: 3})
+	if !errors.Is(err, ErrIncompleteResponse) || !bytes.Equal(attempts[0].Response, []byte{7, 8}) {
+		t.Errorf("err %v attempts %+v", err, attempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := master.Exchange(ctx, &Exchange{Request: []byte{0x14}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err %v", err)
+	}
+}
+
+func TestExchangeTimeout(t *testing.T) {
+	// ожидание транспорта больше Timeout попытки
+	master, err := NewSerialPortPty(time.Second)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	start := time.Now()
+	_, attempts, err := master.Exchange(context.Background(), &Exchange{
+		Request: []byte{1}, Expected: 3, Timeout: 50 * time.Millisecond, Retries: 1,
+	})
+	if !errors.Is(err, ErrTimeout) || len(attempts) != 2 {
+		t.Errorf("err %v attempts %+v", err, attempts)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Error("Timeout попытки не соблюден:", d)
+	}
+
+	// отмена контекста во время чтения
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, _, err = master.Exchange(ctx, &Exchange{Request: []byte{2}, Expected: 3, Retries: 3})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("err %v за %v", err, time.Since(start))
+	}
+}
+
+func TestExchangeEmptyRead(t *testing.T) {
+	// конвертер отвечает пустыми датаграммами: чтение без данных и без ошибки
+	dev, _ := udpPeers(t)
+	s, addr := newUdpSerial(t, dev)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			dev.WriteToUDP(nil, addr)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := s.Exchange(context.Background(), &Exchange{Request: []byte{1}, Expected: 3})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTimeout) {
+			t.Error("ожидался ErrTimeout:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exchange не завершился")
+	}
+}
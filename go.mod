@@ -1,5 +1,5 @@
 module github.com/lasaleks/serialport
 
-go 1.20
+go 1.21
 
 require golang.org/x/sys v0.11.0
@@ -0,0 +1,266 @@
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// GpioConfig describes the RS-485 direction control pins of a
+// transceiver. TxEn drives DE: true enables the driver. RxEn drives /RE
+// as SerialPort.Write does: true while transmitting (receiver off),
+// false to receive. With a shared pin (DE and /RE tied together) RE is
+// -1 and RxEn does nothing.
+type GpioConfig struct {
+	DE        int  // линия DE
+	RE        int  // линия /RE, -1 - общая с DE
+	ActiveLow bool // инверсия уровней (инвертор на плате)
+}
+
+// ErrGpioLine is returned for a bad line number.
+var ErrGpioLine = errors.New("bad gpio line")
+
+func (c *GpioConfig) validate() error {
+	if c.DE < 0 {
+		return &ConfigError{Field: "DE", Value: c.DE, Err: ErrGpioLine}
+	}
+	if c.RE < -1 || c.RE == c.DE {
+		return &ConfigError{Field: "RE", Value: c.RE, Err: ErrGpioLine}
+	}
+	return nil
+}
+
+// GpioSysfs controls the pins through the legacy sysfs GPIO interface.
+type GpioSysfs struct {
+	root     string
+	cfg      GpioConfig
+	de, re   *os.File // файлы value
+	exported []int    // линии, экспортированные нами
+}
+
+// DefaultGpioSysfsRoot is the sysfs GPIO directory.
+const DefaultGpioSysfsRoot = "/sys/class/gpio"
+
+// NewGpioSysfs exports the pins under root (DefaultGpioSysfsRoot if
+// empty), configures them as outputs in receive mode and opens them.
+func NewGpioSysfs(root string, cfg GpioConfig) (*GpioSysfs, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if root == "" {
+		root = DefaultGpioSysfsRoot
+	}
+	g := &GpioSysfs{root: root, cfg: cfg}
+	var err error
+	if g.de, err = g.open(cfg.DE); err != nil {
+		g.Close()
+		return nil, err
+	}
+	if cfg.RE >= 0 {
+		if g.re, err = g.open(cfg.RE); err != nil {
+			g.Close()
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g *GpioSysfs) open(line int) (*os.File, error) {
+	dir := filepath.Join(g.root, "gpio"+strconv.Itoa(line))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := gpioSysfsWrite(filepath.Join(g.root, "export"), strconv.Itoa(line)); err != nil {
+			return nil, err
+		}
+		g.exported = append(g.exported, line)
+		// каталог и права создаются udev не сразу
+		for i := 0; ; i++ {
+			_, err := os.Stat(filepath.Join(dir, "value"))
+			if err == nil {
+				break
+			}
+			if i == 100 {
+				return nil, err
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	active_low := "0"
+	if g.cfg.ActiveLow {
+		active_low = "1"
+	}
+	if err := gpioSysfsWrite(filepath.Join(dir, "active_low"), active_low); err != nil {
+		return nil, err
+	}
+	// "low"/"high" задают выход с начальным физическим уровнем без импульса
+	direction := "low"
+	if g.cfg.ActiveLow {
+		direction = "high"
+	}
+	if err := gpioSysfsWrite(filepath.Join(dir, "direction"), direction); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(dir, "value"), os.O_WRONLY, 0)
+}
+
+// gpioSysfsWrite writes an existing sysfs attribute; a missing one is
+// an error, not created.
+func gpioSysfsWrite(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func gpioSysfsSet(f *os.File, value bool) error {
+	v := []byte{'0'}
+	if value {
+		v[0] = '1'
+	}
+	_, err := f.WriteAt(v, 0)
+	return err
+}
+
+func (g *GpioSysfs) TxEn(value bool) error {
+	if g.de == nil {
+		return os.ErrClosed
+	}
+	return gpioSysfsSet(g.de, value)
+}
+
+func (g *GpioSysfs) RxEn(value bool) error {
+	if g.re == nil {
+		return nil
+	}
+	return gpioSysfsSet(g.re, value)
+}
+
+// Close releases the pins and unexports the lines exported by
+// NewGpioSysfs.
+func (g *GpioSysfs) Close() error {
+	var err error
+	for _, f := range []*os.File{g.de, g.re} {
+		if f != nil {
+			if e := f.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	g.de, g.re = nil, nil
+	for _, line := range g.exported {
+		if e := gpioSysfsWrite(filepath.Join(g.root, "unexport"), strconv.Itoa(line)); e != nil && err == nil {
+			err = fmt.Errorf("unexport %d: %w", line, e)
+		}
+	}
+	g.exported = nil
+	return err
+}
+
+// GpioModeConfig describes the mode pins of a multiprotocol transceiver
+// (e.g. SP339, MAX13235): Modes holds the levels of Lines for every
+// supported line mode.
+type GpioModeConfig struct {
+	Lines     []int
+	Modes     map[LineMode][]bool
+	ActiveLow bool
+}
+
+func (c *GpioModeConfig) validate() error {
+	if len(c.Lines) == 0 {
+		return &ConfigError{Field: "Lines", Value: c.Lines, Err: ErrGpioLine}
+	}
+	for _, line := range c.Lines {
+		if line < 0 {
+			return &ConfigError{Field: "Lines", Value: c.Lines, Err: ErrGpioLine}
+		}
+	}
+	for mode, values := range c.Modes {
+		if len(values) != len(c.Lines) {
+			return &ConfigError{Field: "Modes", Value: mode, Err: ErrGpioLine}
+		}
+	}
+	return nil
+}
+
+// GpioMode switches the line mode of a transceiver through GPIO pins.
+// It implements ModeSwitch.
+type GpioMode struct {
+	cfg   GpioModeConfig
+	set   func(values []bool) error
+	close func() error
+}
+
+// SetMode sets the pins for mode, ErrBadLineMode if mode is not in
+// GpioModeConfig.Modes.
+func (m *GpioMode) SetMode(mode LineMode) error {
+	values, ok := m.cfg.Modes[mode]
+	if !ok {
+		return &ConfigError{Field: "LineMode", Value: mode, Err: ErrBadLineMode}
+	}
+	if m.set == nil {
+		return os.ErrClosed
+	}
+	return m.set(values)
+}
+
+// Close releases the pins.
+func (m *GpioMode) Close() error {
+	if m.close == nil {
+		return nil
+	}
+	err := m.close()
+	m.set, m.close = nil, nil
+	return err
+}
+
+// NewGpioModeSysfs exports the mode pins under root
+// (DefaultGpioSysfsRoot if empty) as outputs set to 0.
+func NewGpioModeSysfs(root string, cfg GpioModeConfig) (*GpioMode, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if root == "" {
+		root = DefaultGpioSysfsRoot
+	}
+	g := &GpioSysfs{root: root, cfg: GpioConfig{ActiveLow: cfg.ActiveLow}}
+	files := make([]*os.File, len(cfg.Lines))
+	closeAll := func() error {
+		var err error
+		for _, f := range files {
+			if f != nil {
+				if e := f.Close(); e != nil && err == nil {
+					err = e
+				}
+			}
+		}
+		if e := g.Close(); e != nil && err == nil {
+			err = e
+		}
+		return err
+	}
+	for i, line := range cfg.Lines {
+		f, err := g.open(line)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		files[i] = f
+	}
+	m := &GpioMode{cfg: cfg, close: closeAll}
+	m.set = func(values []bool) error {
+		for i, v := range values {
+			if err := gpioSysfsSet(files[i], v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return m, nil
+}
@@ -0,0 +1,180 @@
+package serialport
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// GPIO v2 character device uAPI, linux/gpio.h
+const (
+	gpioV2LinesMax          = 64
+	gpioV2LineNumAttrsMax   = 10
+	gpioMaxNameSize         = 32
+	gpioV2LineFlagActiveLow = 1 << 1
+	gpioV2LineFlagOutput    = 1 << 3
+	gpioV2LineAttrIdValues  = 2 // GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES
+
+	gpioV2GetLineIoctl       = 0xC250B407 // _IOWR(0xB4, 0x07, struct gpio_v2_line_request)
+	gpioV2LineSetValuesIoctl = 0xC010B40F // _IOWR(0xB4, 0x0F, struct gpio_v2_line_values)
+)
+
+type gpioV2LineAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64 // flags, values или debounce_period_us
+}
+
+type gpioV2LineConfigAttribute struct {
+	attr gpioV2LineAttribute
+	mask uint64
+}
+
+type gpioV2LineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [gpioV2LineNumAttrsMax]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	offsets         [gpioV2LinesMax]uint32
+	consumer        [gpioMaxNameSize]byte
+	config          gpioV2LineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type gpioV2LineValues struct {
+	bits uint64
+	mask uint64
+}
+
+// GpioChardev controls the pins through the GPIO v2 character device
+// (/dev/gpiochipN). Both pins are requested as one line request.
+type GpioChardev struct {
+	cfg GpioConfig
+	f   *os.File // дескриптор запроса линий
+}
+
+// NewGpioChardev requests the pins of chip (e.g. "/dev/gpiochip0") as
+// outputs in receive mode.
+func NewGpioChardev(chip string, cfg GpioConfig) (*GpioChardev, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	lines := []int{cfg.DE}
+	if cfg.RE >= 0 {
+		lines = append(lines, cfg.RE)
+	}
+	f, err := gpioRequestLines(chip, lines, cfg.ActiveLow)
+	if err != nil {
+		return nil, err
+	}
+	return &GpioChardev{cfg: cfg, f: f}, nil
+}
+
+// gpioRequestLines requests lines of chip as outputs set to 0 and
+// returns the descriptor of the request.
+func gpioRequestLines(chip string, lines []int, activeLow bool) (*os.File, error) {
+	c, err := os.OpenFile(chip, os.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var req gpioV2LineRequest
+	for i, line := range lines {
+		req.offsets[i] = uint32(line)
+	}
+	req.numLines = uint32(len(lines))
+	copy(req.consumer[:gpioMaxNameSize-1], "serialport")
+	req.config.flags = gpioV2LineFlagOutput
+	if activeLow {
+		req.config.flags |= gpioV2LineFlagActiveLow
+	}
+	// начальные значения 0 - прием
+	req.config.numAttrs = 1
+	req.config.attrs[0] = gpioV2LineConfigAttribute{
+		attr: gpioV2LineAttribute{id: gpioV2LineAttrIdValues, value: 0},
+		mask: 1<<req.numLines - 1,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, c.Fd(), gpioV2GetLineIoctl, uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		return nil, &os.PathError{Op: "gpio line request", Path: chip, Err: errno}
+	}
+	return os.NewFile(uintptr(req.fd), chip), nil
+}
+
+// gpioSetLines sets the lines of a request selected by mask to bits.
+func gpioSetLines(f *os.File, bits, mask uint64) error {
+	if f == nil {
+		return os.ErrClosed
+	}
+	v := gpioV2LineValues{bits: bits, mask: mask}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), gpioV2LineSetValuesIoctl, uintptr(unsafe.Pointer(&v)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// set sets the line with index idx of the request.
+func (g *GpioChardev) set(idx uint, value bool) error {
+	var bits uint64
+	if value {
+		bits = 1 << idx
+	}
+	return gpioSetLines(g.f, bits, 1<<idx)
+}
+
+func (g *GpioChardev) TxEn(value bool) error {
+	return g.set(0, value)
+}
+
+func (g *GpioChardev) RxEn(value bool) error {
+	if g.cfg.RE < 0 {
+		return nil
+	}
+	return g.set(1, value)
+}
+
+// Close releases the lines.
+func (g *GpioChardev) Close() error {
+	if g.f == nil {
+		return nil
+	}
+	err := g.f.Close()
+	g.f = nil
+	return err
+}
+
+// NewGpioModeChardev requests the mode pins of chip (e.g.
+// "/dev/gpiochip0") as outputs.
+func NewGpioModeChardev(chip string, cfg GpioModeConfig) (*GpioMode, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Lines) > gpioV2LinesMax {
+		return nil, &ConfigError{Field: "Lines", Value: cfg.Lines, Err: ErrGpioLine}
+	}
+	f, err := gpioRequestLines(chip, cfg.Lines, cfg.ActiveLow)
+	if err != nil {
+		return nil, err
+	}
+	m := &GpioMode{cfg: cfg}
+	m.set = func(values []bool) error {
+		var bits uint64
+		for i, v := range values {
+			if v {
+				bits |= 1 << i
+			}
+		}
+		return gpioSetLines(f, bits, 1<<len(values)-1)
+	}
+	m.close = f.Close
+	return m, nil
+}
@@ -0,0 +1,154 @@
+package serialport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"unsafe"
+)
+
+func TestGpioV2Layout(t *testing.T) {
+	// размеры структур linux/gpio.h
+	if s := unsafe.Sizeof(gpioV2LineRequest{}); s != 592 {
+		t.Errorf("gpio_v2_line_request %d", s)
+	}
+	if s := unsafe.Sizeof(gpioV2LineConfig{}); s != 272 {
+		t.Errorf("gpio_v2_line_config %d", s)
+	}
+	if s := unsafe.Sizeof(gpioV2LineValues{}); s != 16 {
+		t.Errorf("gpio_v2_line_values %d", s)
+	}
+	if _, err := NewGpioChardev("/nonexistent/gpiochip0", GpioConfig{DE: 1, RE: -1}); err == nil {
+		t.Error("нет ошибки для несуществующего чипа")
+	}
+}
+
+// fakeSysfs создает каталог как /sys/class/gpio; linesPresent - уже экспортированные линии
+func fakeSysfs(t *testing.T, linesPresent ...int) string {
+	root := t.TempDir()
+	for _, f := range []string{"export", "unexport"} {
+		os.WriteFile(filepath.Join(root, f), nil, 0644)
+	}
+	for _, line := range linesPresent {
+		dir := filepath.Join(root, "gpio"+strconv.Itoa(line))
+		os.Mkdir(dir, 0755)
+		for _, f := range []string{"value", "direction", "active_low"} {
+			os.WriteFile(filepath.Join(dir, f), nil, 0644)
+		}
+	}
+	return root
+}
+
+func readSysfs(t *testing.T, root string, line int, attr string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(root, "gpio"+strconv.Itoa(line), attr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestGpioSysfs(t *testing.T) {
+	root := fakeSysfs(t, 17, 18)
+	g, err := NewGpioSysfs(root, GpioConfig{DE: 17, RE: 18, ActiveLow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readSysfs(t, root, 17, "direction") != "high" || readSysfs(t, root, 18, "active_low") != "1" {
+		t.Error("начальная настройка линий")
+	}
+	g.TxEn(true)
+	g.RxEn(true)
+	if readSysfs(t, root, 17, "value") != "1" || readSysfs(t, root, 18, "value") != "1" {
+		t.Error("передача")
+	}
+	g.TxEn(false)
+	if readSysfs(t, root, 17, "value") != "0" {
+		t.Error("прием")
+	}
+	g.Close()
+	if err := g.TxEn(true); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("err %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "unexport")); len(b) != 0 {
+		t.Errorf("unexport чужой линии %q", b)
+	}
+
+	// общий пин DE и /RE
+	g, err = NewGpioSysfs(root, GpioConfig{DE: 17, RE: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readSysfs(t, root, 17, "direction") != "low" || readSysfs(t, root, 17, "active_low") != "0" {
+		t.Error("настройка общего пина")
+	}
+	if err := g.RxEn(true); err != nil {
+		t.Error(err)
+	}
+	g.Close()
+
+	if _, err := NewGpioSysfs(root, GpioConfig{DE: 17, RE: 17}); err == nil {
+		t.Error("DE и RE на одной линии")
+	}
+	// линия не экспортирована и каталог не появился
+	if _, err := NewGpioSysfs(root, GpioConfig{DE: 20, RE: -1}); err == nil {
+		t.Error("нет ошибки экспорта")
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "export")); string(b) != "20" {
+		t.Errorf("export %q", b)
+	}
+}
+
+func TestGpioModeSysfs(t *testing.T) {
+	root := fakeSysfs(t, 5, 6)
+	cfg := GpioModeConfig{
+		Lines: []int{5, 6},
+		Modes: map[LineMode][]bool{
+			RS232: {false, false},
+			RS485: {true, false},
+			RS422: {true, true},
+		},
+	}
+	m, err := NewGpioModeSysfs(root, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetMode(RS485); err != nil {
+		t.Fatal(err)
+	}
+	if readSysfs(t, root, 5, "value") != "1" || readSysfs(t, root, 6, "value") != "0" {
+		t.Error("режим RS-485")
+	}
+	if err := m.SetMode(RS485FourWire); !errors.Is(err, ErrBadLineMode) {
+		t.Errorf("неподдерживаемый режим: %v", err)
+	}
+	m.Close()
+	if err := m.SetMode(RS232); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("err %v", err)
+	}
+
+	cfg.Modes[RS485] = []bool{true}
+	if _, err := NewGpioModeSysfs(root, cfg); !errors.Is(err, ErrGpioLine) {
+		t.Errorf("неверное число уровней: %v", err)
+	}
+}
+
+func TestGpioSysfsWrongRoot(t *testing.T) {
+	// каталог без атрибутов sysfs
+	root := t.TempDir()
+	if _, err := NewGpioSysfs(root, GpioConfig{DE: 3, RE: -1}); err == nil {
+		t.Error("нет ошибки для неверного корня")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("созданы файлы %v", entries)
+	}
+	os.Mkdir(filepath.Join(root, "gpio3"), 0755)
+	if _, err := NewGpioSysfs(root, GpioConfig{DE: 3, RE: -1}); err == nil {
+		t.Error("нет ошибки без active_low")
+	}
+	if _, err := os.Stat(filepath.Join(root, "gpio3", "active_low")); !os.IsNotExist(err) {
+		t.Error("создан active_low")
+	}
+}
@@ -0,0 +1,163 @@
+package serialport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ctxPoll limits a single wait of ReadContext, so that cancellation of
+// a context without deadline is noticed.
+const ctxPoll = 100 * time.Millisecond
+
+// ReadContext is Read that stops waiting for the bus and for data when
+// ctx is done. It returns ErrTimeout after the read timeout of the
+// transport like Read, or ctx.Err() if ctx is done first.
+func (s *SerialPort) ReadContext(ctx context.Context, buf []byte, estimated_byte int) (int, error) {
+	if err := s.bus.lock(ctx, PriorityNormal); err != nil {
+		return 0, err
+	}
+	defer s.bus.unlock()
+	return s.readContext(ctx, buf, estimated_byte)
+}
+
+func (s *SerialPort) readContext(ctx context.Context, buf []byte, estimated_byte int) (int, error) {
+	end := time.Now().Add(s.readWait())
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		wait := time.Until(end)
+		if wait <= 0 {
+			return s.accountRead(0, ErrTimeout)
+		}
+		if d, ok := ctx.Deadline(); ok && time.Until(d) < wait {
+			wait = time.Until(d)
+		}
+		if wait > ctxPoll {
+			wait = ctxPoll
+		}
+		n, err := s.read(ctx, buf, estimated_byte, wait)
+		if err == ErrTimeout {
+			// время передачи ожидаемых байт учтено в первом ожидании
+			estimated_byte = 0
+			continue
+		}
+		if cerr := ctx.Err(); cerr != nil && err == cerr {
+			return 0, err
+		}
+		return s.accountRead(n, err)
+	}
+}
+
+// ReadPoll is Read waiting up to wait instead of the transport read
+// timeout, so the bus is held only that long. Polling with a short wait
+// lets writes of other goroutines in between, e.g. in TcpServer.
+func (s *SerialPort) ReadPoll(buf []byte, wait time.Duration) (int, error) {
+	s.acquire()
+	defer s.bus.unlock()
+	n, err := s.read(context.Background(), buf, 0, wait)
+	if err == ErrTimeout {
+		// пустой опрос - не таймаут обмена
+		return 0, err
+	}
+	return s.accountRead(n, err)
+}
+
+// WriteContext is Write that stops waiting for the bus when ctx is done.
+// The write itself is not interrupted.
+func (s *SerialPort) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	if err := s.bus.lock(ctx, PriorityNormal); err != nil {
+		return 0, err
+	}
+	defer s.bus.unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.writeTx(buf)
+}
+
+// ReadContext is SerialPort.ReadContext inside the transaction.
+func (tx *Tx) ReadContext(ctx context.Context, b []byte, estimated_byte int) (int, error) {
+	return tx.s.readContext(ctx, b, estimated_byte)
+}
+
+// ReadWriter adapts a transport to io.ReadWriteCloser, e.g. for bufio,
+// io.Copy or encoding/binary.
+//
+// Read passes the estimated byte count (see SetEstimatedByte, limited by
+// len(p)) to the transport and returns what it got. When the transport
+// times out, Read returns ErrTimeout (a net.Error with Timeout() true),
+// or in blocking mode keeps waiting until data arrives or Close.
+// Write writes all of p.
+type ReadWriter struct {
+	s         InterfaceSerial
+	estimated int
+	blocking  bool
+	closed    atomic.Bool
+}
+
+// NewReadWriter creates an adapter of s.
+func NewReadWriter(s InterfaceSerial) *ReadWriter {
+	return &ReadWriter{s: s}
+}
+
+// SetEstimatedByte sets the estimated_byte passed to the transport Read.
+func (rw *ReadWriter) SetEstimatedByte(n int) {
+	rw.estimated = n
+}
+
+// SetBlocking makes Read wait for data instead of returning ErrTimeout.
+func (rw *ReadWriter) SetBlocking(blocking bool) {
+	rw.blocking = blocking
+}
+
+func (rw *ReadWriter) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	e := rw.estimated
+	if e > len(p) {
+		e = len(p)
+	}
+	for {
+		if rw.closed.Load() {
+			return 0, net.ErrClosed
+		}
+		n, err := rw.s.Read(p, e)
+		if n > 0 {
+			// ошибка вернется следующим Read
+			return n, nil
+		}
+		if err == nil || (rw.blocking && errors.Is(err, ErrTimeout)) {
+			continue
+		}
+		return 0, err
+	}
+}
+
+func (rw *ReadWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := rw.s.Write(p[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// Close closes the transport and ends a blocked Read.
+func (rw *ReadWriter) Close() error {
+	rw.closed.Store(true)
+	return rw.s.Close()
+}
+
+var _ io.ReadWriteCloser = (*ReadWriter)(nil)
@@ -0,0 +1,131 @@
+package serialport
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadWriter(t *testing.T) {
+	master, err := NewSerialPortPty(30 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	rw := NewReadWriter(master)
+	if err := binary.Write(rw, binary.BigEndian, uint32(0x01020304)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if n, err := io.ReadAtLeast(slave.f, buf, 4); err != nil || n != 4 || buf[0] != 1 || buf[3] != 4 {
+		t.Errorf("slave read %X %v", buf[:n], err)
+	}
+
+	// ErrTimeout без блокировки
+	if _, err := rw.Read(buf); !errors.Is(err, ErrTimeout) {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+	var ne net.Error
+	if _, err := rw.Read(buf); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("ожидается net.Error, получено %v", err)
+	}
+
+	// блокирующий режим: ответ позже таймаута транспорта
+	rw.SetBlocking(true)
+	go func() {
+		time.Sleep(80 * time.Millisecond)
+		slave.Write([]byte("line one\n"))
+	}()
+	line, err := bufio.NewReader(rw).ReadString('\n')
+	if err != nil || line != "line one\n" {
+		t.Errorf("line %q %v", line, err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := rw.Read(buf)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	rw.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("err %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read не завершился после Close")
+	}
+}
+
+func TestReadWriteContext(t *testing.T) {
+	master, err := NewSerialPortPty(time.Second)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	// контекст короче таймаута транспорта
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	buf := make([]byte, 8)
+	if _, err := master.ReadContext(ctx, buf, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("ReadContext ждал %s", d)
+	}
+
+	// отмена без дедлайна
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	time.AfterFunc(30*time.Millisecond, cancel2)
+	if _, err := master.ReadContext(ctx2, buf, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("err %v", err)
+	}
+
+	// отмена во время ожидания передачи ожидаемых байт (8 * 1s)
+	master.config_stty.oneSymbolDuration = time.Second
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	time.AfterFunc(30*time.Millisecond, cancel3)
+	start = time.Now()
+	if _, err := master.ReadContext(ctx3, buf, len(buf)); !errors.Is(err, context.Canceled) {
+		t.Errorf("err %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("ReadContext ждал %s", d)
+	}
+	master.config_stty.oneSymbolDuration = 0
+
+	slave.Write([]byte{7})
+	if n, err := master.ReadContext(context.Background(), buf, 0); err != nil || n != 1 || buf[0] != 7 {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	if n, err := master.WriteContext(context.Background(), []byte{1, 2}); err != nil || n != 2 {
+		t.Errorf("write %d %v", n, err)
+	}
+	if _, err := master.WriteContext(ctx2, []byte{1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package serialport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// LineMode is the electrical interface of a stty port. The values of
+// RS232, RS422 and RS485 are the numbers formerly passed as typeRS.
+type LineMode int
+
+const (
+	RS232         LineMode = 232
+	RS422         LineMode = 422
+	RS485         LineMode = 485  // двухпроводный, полудуплекс
+	RS485FourWire LineMode = 4854 // четырехпроводный, полный дуплекс
+)
+
+// ErrBadLineMode is returned for an unknown line mode.
+var ErrBadLineMode = errors.New("unsupported line mode")
+
+// ErrEcho is returned by a two-wire RS-485 write with echo cancelling
+// when the echo differs from the data sent (bus collision) or is
+// missing.
+var ErrEcho = errors.New("echo mismatch")
+
+// ErrNoAddressing is returned by WriteAddressed in RS-232 mode.
+var ErrNoAddressing = errors.New("multi-drop addressing needs RS-422 or RS-485")
+
+func (m LineMode) String() string {
+	switch m {
+	case RS232:
+		return "RS-232"
+	case RS422:
+		return "RS-422"
+	case RS485:
+		return "RS-485"
+	case RS485FourWire:
+		return "RS-485 4-wire"
+	}
+	return fmt.Sprintf("LineMode(%d)", int(m))
+}
+
+func (m LineMode) validate() error {
+	switch m {
+	case RS232, RS422, RS485, RS485FourWire:
+		return nil
+	}
+	return &ConfigError{Field: "LineMode", Value: int(m), Err: ErrBadLineMode}
+}
+
+// ParseLineMode converts "232", "422", "485" or "485-4w" (with an
+// optional "rs" prefix, any case) to LineMode.
+func ParseLineMode(v string) (LineMode, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "rs") {
+	case "", "232":
+		return RS232, nil
+	case "422":
+		return RS422, nil
+	case "485", "485-2w":
+		return RS485, nil
+	case "485-4w", "4854":
+		return RS485FourWire, nil
+	}
+	return 0, &ConfigError{Field: "LineMode", Value: v, Err: ErrBadLineMode}
+}
+
+// ModeSwitch selects the line mode of a multiprotocol transceiver.
+type ModeSwitch interface {
+	SetMode(mode LineMode) error
+}
+
+// LineMode returns the line mode of the stty port.
+func (s *SerialPort) LineMode() LineMode {
+	return s.config_stty.typeRS
+}
+
+// SetLineMode changes the line mode. If a ModeSwitch is set and the port
+// is open, the transceiver is switched at once, else on next Connect.
+func (s *SerialPort) SetLineMode(mode LineMode) error {
+	if err := mode.validate(); err != nil {
+		return err
+	}
+	s.acquire()
+	defer s.bus.unlock()
+	if s.mode_switch != nil && s.stty != nil && s.type_serial == type_serial_stty {
+		// режим меняется, только если приемопередатчик переключился
+		if err := s.mode_switch.SetMode(mode); err != nil {
+			return err
+		}
+	}
+	s.config_stty.typeRS = mode
+	return nil
+}
+
+// SetModeSwitch sets the mode switch of the transceiver, applied on
+// Connect and by SetLineMode.
+func (s *SerialPort) SetModeSwitch(m ModeSwitch) {
+	s.acquire()
+	defer s.bus.unlock()
+	s.mode_switch = m
+}
+
+// SetEchoCancel makes two-wire RS-485 writes read back and check the
+// echo of the data sent, for transceivers with the receiver always
+// enabled. A differing or missing echo is reported as ErrEcho.
+func (s *SerialPort) SetEchoCancel(on bool) {
+	s.acquire()
+	defer s.bus.unlock()
+	s.echo_cancel = on
+}
+
+// WriteAddressed sends a multi-drop frame in 9-bit mode: addr with the
+// parity bit set (mark) and data with it cleared (space), in one
+// driver enable window. The configured parity is restored afterwards.
+// Returns the number of data bytes written.
+func (s *SerialPort) WriteAddressed(addr byte, data []byte) (int, error) {
+	s.acquire()
+	defer s.bus.unlock()
+	return s.writeAddressed(addr, data)
+}
+
+// WriteAddressed is SerialPort.WriteAddressed inside the transaction.
+func (tx *Tx) WriteAddressed(addr byte, data []byte) (int, error) {
+	return tx.s.writeAddressed(addr, data)
+}
+
+func (s *SerialPort) writeAddressed(addr byte, data []byte) (int, error) {
+	if s.type_serial != type_serial_stty {
+		return 0, &ConfigError{Field: "type_serial", Value: s.type_serial, Err: ErrBadTransport}
+	}
+	if s.config_stty.typeRS == RS232 {
+		return 0, ErrNoAddressing
+	}
+	if s.stty == nil {
+		return 0, net.ErrClosed
+	}
+	parity := s.config_stty.parity
+	if parity == 0 {
+		parity = ParityNone
+	}
+	frame := append([]byte{addr}, data...)
+	n, err := s.accountWrite(s.transmit(frame, true, func() (int, error) {
+		if err := s.stty.SetParity(ParityMark); err != nil {
+			return 0, err
+		}
+		if _, err := s.stty.Write(frame[:1]); err != nil {
+			return 0, err
+		}
+		// смена termios действует сразу, адрес должен уйти из FIFO
+		if _, err := s.stty.Drain(); err != nil {
+			return 1, err
+		}
+		if err := s.stty.SetParity(ParitySpace); err != nil {
+			return 1, err
+		}
+		n, err := s.stty.Write(data)
+		return 1 + n, err
+	}))
+	if n > 0 {
+		n--
+	}
+	// восстановление четности тоже только после ухода данных
+	if _, e := s.stty.Drain(); e != nil && err == nil {
+		err = e
+	}
+	if e := s.stty.SetParity(parity); e != nil && err == nil {
+		err = e
+	}
+	return n, err
+}
+
+// readEcho reads back len(sent) bytes of echo.
+func (s *SerialPort) readEcho(sent []byte) error {
+	echo := make([]byte, len(sent))
+	got := 0
+	end := time.Now().Add(s.config_stty.wait)
+	for got < len(echo) {
+		wait := time.Until(end)
+		if wait <= 0 || s.stty.Wait(wait.Milliseconds()) == 0 {
+			break
+		}
+		// читаем не больше эха, ответ остается в буфере
+		n, err := s.stty.Read(echo[got:])
+		if err != nil {
+			return err
+		}
+		got += n
+	}
+	if !bytes.Equal(echo[:got], sent) {
+		return &EchoError{Sent: sent, Got: echo[:got]}
+	}
+	return nil
+}
+
+// EchoError reports a bad echo of a two-wire RS-485 write.
+type EchoError struct {
+	Sent []byte
+	Got  []byte
+}
+
+func (e *EchoError) Error() string {
+	return fmt.Sprintf("echo: sent % X, got % X", e.Sent, e.Got)
+}
+
+func (e *EchoError) Is(target error) bool { return target == ErrEcho }
@@ -0,0 +1,170 @@
+package serialport
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLineMode(t *testing.T) {
+	tt := []struct {
+		v    string
+		mode LineMode
+		err  bool
+	}{
+		{"", RS232, false},
+		{"232", RS232, false},
+		{"RS422", RS422, false},
+		{"485", RS485, false},
+		{"rs485-4w", RS485FourWire, false},
+		{"458", 0, true},
+	}
+	for _, tc := range tt {
+		m, err := ParseLineMode(tc.v)
+		if (err != nil) != tc.err || m != tc.mode {
+			t.Errorf("%q: %v %v", tc.v, m, err)
+		}
+	}
+	if _, err := NewSerialPortStty("/dev/ttyS0", 9600, time.Second, 458, nil); !errors.Is(err, ErrBadLineMode) {
+		t.Error("опечатка в режиме не обнаружена:", err)
+	}
+	if RS485FourWire.String() != "RS-485 4-wire" {
+		t.Error(RS485FourWire.String())
+	}
+}
+
+// ptyStty открывает слейв pty как stty порт в режиме mode
+func ptyStty(t *testing.T, mode LineMode, ctrl ICtrlTxRxEn) (*SerialPort, *SerialPort) {
+	t.Helper()
+	master, err := NewSerialPortPty(30 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	s, err := NewSerialPortStty(master.PtyName(), 115200, 50*time.Millisecond, mode, ctrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return master, s
+}
+
+func TestLineModeDirection(t *testing.T) {
+	for _, tc := range []struct {
+		mode  LineMode
+		calls string
+	}{
+		{RS232, ""},
+		{RS422, ""},
+		{RS485, "tx+ rx+ tx- rx-"},
+		{RS485FourWire, "tx+ tx-"},
+	} {
+		ctrl := &recordCtrl{}
+		_, s := ptyStty(t, tc.mode, ctrl)
+		if _, err := s.Write([]byte{1}); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(ctrl.calls, " "); got != tc.calls {
+			t.Errorf("%v: %q", tc.mode, got)
+		}
+	}
+}
+
+func TestEchoCancel(t *testing.T) {
+	master, s := ptyStty(t, RS485, nil)
+	s.SetEchoCancel(true)
+
+	// эхо через мастер pty, с искажением при corrupt
+	echo := func(corrupt bool) {
+		buf := make([]byte, 16)
+		n, err := master.Read(buf, 0)
+		if err != nil {
+			return
+		}
+		if corrupt {
+			buf[0] ^= 0xFF
+		}
+		// эхо и начало ответа
+		master.Write(append(buf[:n:n], 0x55))
+	}
+
+	go echo(false)
+	if _, err := s.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatal("эхо не принято:", err)
+	}
+	buf := make([]byte, 8)
+	if n, err := s.Read(buf, 0); err != nil || n != 1 || buf[0] != 0x55 {
+		t.Errorf("ответ после эха % X %v", buf[:n], err)
+	}
+
+	go echo(true)
+	var ee *EchoError
+	if _, err := s.Write([]byte{1, 2, 3}); !errors.Is(err, ErrEcho) || !errors.As(err, &ee) || len(ee.Got) != 3 {
+		t.Error("ожидалась ошибка эха:", err)
+	}
+
+	// эха нет
+	if _, err := s.Write([]byte{4}); !errors.Is(err, ErrEcho) {
+		t.Error("ожидалась ошибка без эха:", err)
+	}
+}
+
+func TestWriteAddressed(t *testing.T) {
+	_, s := ptyStty(t, RS232, nil)
+	if _, err := s.WriteAddressed(1, []byte{2}); !errors.Is(err, ErrNoAddressing) {
+		t.Error("адресация в RS-232:", err)
+	}
+
+	master, s := ptyStty(t, RS485, nil)
+	n, err := s.WriteAddressed(0x11, []byte{1, 2})
+	if err != nil {
+		t.Skip("mark/space четность не поддерживается:", err)
+	}
+	if n != 2 {
+		t.Errorf("записано %d", n)
+	}
+	buf := make([]byte, 8)
+	got := 0
+	for got < 3 {
+		n, err := master.Read(buf[got:], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got += n
+	}
+	if !bytes.Equal(buf[:got], []byte{0x11, 1, 2}) {
+		t.Errorf("кадр % X", buf[:got])
+	}
+	// четность порта восстановлена
+	if s.stty.parity != ParityNone {
+		t.Errorf("четность после кадра %c", s.stty.parity)
+	}
+}
+
+type failSwitch struct{ err error }
+
+func (f failSwitch) SetMode(LineMode) error { return f.err }
+
+func TestSetLineModeSwitchFail(t *testing.T) {
+	_, s := ptyStty(t, RS485, nil)
+	errSwitch := errors.New("gpio")
+	s.SetModeSwitch(failSwitch{errSwitch})
+	if err := s.SetLineMode(RS422); !errors.Is(err, errSwitch) {
+		t.Fatal(err)
+	}
+	if s.LineMode() != RS485 {
+		t.Error("режим изменен без переключения приемопередатчика:", s.LineMode())
+	}
+	s.SetModeSwitch(failSwitch{})
+	if err := s.SetLineMode(RS422); err != nil || s.LineMode() != RS422 {
+		t.Error(s.LineMode(), err)
+	}
+}
@@ -0,0 +1,123 @@
+package serialport
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+)
+
+// DefaultLogMaxBytes limits the data dump of a log record.
+const DefaultLogMaxBytes = 256
+
+// LogConfig configures structured logging of a transport.
+type LogConfig struct {
+	// Logger receives the records. If nil, logging is off unless the
+	// global LogPrintData is set, then slog.Default() is used at Info level.
+	Logger *slog.Logger
+
+	// Level of data records; events like dropped datagrams are logged at Warn.
+	Level slog.Level
+
+	// MaxBytes limits the dumped bytes of one record. If 0,
+	// DefaultLogMaxBytes is used, negative means no limit.
+	MaxBytes int
+
+	// Port is the value of the "port" attribute. If empty, the
+	// transport's own name (device, address) is used.
+	Port string
+}
+
+// dataLogger is embedded in transports to provide SetLog.
+type dataLogger struct {
+	log_config LogConfig
+	log_port   string // имя транспорта по умолчанию
+}
+
+// SetLog sets per-port logging of transferred data.
+func (d *dataLogger) SetLog(c LogConfig) {
+	d.log_config = c
+}
+
+func (d *dataLogger) logger() (*slog.Logger, slog.Level) {
+	if d.log_config.Logger != nil {
+		return d.log_config.Logger, d.log_config.Level
+	}
+	if LogPrintData {
+		return slog.Default(), slog.LevelInfo
+	}
+	return nil, 0
+}
+
+func (d *dataLogger) portName() string {
+	if d.log_config.Port != "" {
+		return d.log_config.Port
+	}
+	return d.log_port
+}
+
+// logData logs a data chunk with hex and ASCII dumps.
+func (d *dataLogger) logData(dir Direction, data []byte, attrs ...slog.Attr) {
+	l, level := d.logger()
+	if l == nil || !l.Enabled(context.Background(), level) {
+		return
+	}
+	max := d.log_config.MaxBytes
+	if max == 0 {
+		max = DefaultLogMaxBytes
+	}
+	dump := data
+	if max > 0 && len(dump) > max {
+		dump = dump[:max]
+	}
+	a := make([]slog.Attr, 0, 6+len(attrs))
+	a = append(a,
+		slog.String("port", d.portName()),
+		slog.String("dir", dir.String()),
+		slog.Int("len", len(data)),
+		slog.String("hex", hexDump(dump)),
+		slog.String("ascii", asciiDump(dump)),
+	)
+	if len(dump) < len(data) {
+		a = append(a, slog.Bool("truncated", true))
+	}
+	a = append(a, attrs...)
+	l.LogAttrs(context.Background(), level, "data", a...)
+}
+
+// logEvent logs a transport event at Warn level.
+func (d *dataLogger) logEvent(msg string, attrs ...slog.Attr) {
+	l, _ := d.logger()
+	if l == nil {
+		return
+	}
+	a := append([]slog.Attr{slog.String("port", d.portName())}, attrs...)
+	l.LogAttrs(context.Background(), slog.LevelWarn, msg, a...)
+}
+
+func hexDump(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	out := make([]byte, 0, len(b)*3)
+	var tmp [2]byte
+	for i, c := range b {
+		if i > 0 {
+			out = append(out, ' ')
+		}
+		hex.Encode(tmp[:], []byte{c})
+		out = append(out, tmp[:]...)
+	}
+	return string(out)
+}
+
+func asciiDump(b []byte) string {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		if c >= 0x20 && c < 0x7F {
+			out[i] = c
+		} else {
+			out[i] = '.'
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,74 @@
+package serialport
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLogData(t *testing.T) {
+	var out bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	var d dataLogger
+	d.log_port = "/dev/ttyS0"
+	d.SetLog(LogConfig{Logger: l, Level: slog.LevelDebug, MaxBytes: 4})
+	d.logData(DirWrite, []byte{0x01, 'A', 0x7F, 'b', 0xFF}, slog.String("peer", "x"))
+
+	var rec map[string]any
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatal(err, out.String())
+	}
+	want := map[string]any{
+		"level":     "DEBUG",
+		"msg":       "data",
+		"port":      "/dev/ttyS0",
+		"dir":       "write",
+		"len":       float64(5),
+		"hex":       "01 41 7f 62",
+		"ascii":     ".A.b",
+		"truncated": true,
+		"peer":      "x",
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s: получено %v, ожидалось %v", k, rec[k], v)
+		}
+	}
+}
+
+func TestLogDataLevel(t *testing.T) {
+	var out bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	var d dataLogger
+	d.SetLog(LogConfig{Logger: l, Level: slog.LevelDebug, Port: "plc"})
+	d.logData(DirRead, []byte{1, 2, 3})
+	if out.Len() != 0 {
+		t.Errorf("запись ниже уровня логгера: %s", out.String())
+	}
+	d.logEvent("drop datagram")
+	if !bytes.Contains(out.Bytes(), []byte("port=plc")) {
+		t.Errorf("нет атрибута port: %s", out.String())
+	}
+}
+
+func TestLogPrintDataFallback(t *testing.T) {
+	var out bytes.Buffer
+	def := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&out, nil)))
+	defer slog.SetDefault(def)
+	defer func() { LogPrintData = false }()
+
+	var d dataLogger
+	d.logData(DirRead, []byte{1})
+	if out.Len() != 0 {
+		t.Fatalf("логирование без логгера: %s", out.String())
+	}
+	LogPrintData = true
+	d.logData(DirRead, []byte{1})
+	if !bytes.Contains(out.Bytes(), []byte("hex=01")) {
+		t.Errorf("нет записи через slog.Default: %s", out.String())
+	}
+}
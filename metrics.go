@@ -0,0 +1,297 @@
+package serialport
+
+import (
+	"bufio"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names. Histograms are in seconds.
+const (
+	MetricBytes       = "serialport_bytes_total"              // port, dir
+	MetricFrames      = "serialport_frames_total"             // port, dir
+	MetricTimeouts    = "serialport_timeouts_total"           // port
+	MetricErrors      = "serialport_errors_total"             // port, op
+	MetricReconnects  = "serialport_reconnects_total"         // port
+	MetricSlipErrors  = "serialport_slip_errors_total"        // port, kind: overflow, escape, crc
+	MetricTransaction = "serialport_transaction_seconds"      // port
+	MetricTurnaround  = "serialport_rs485_turnaround_seconds" // port
+)
+
+var metricHelp = map[string]string{
+	MetricBytes:       "Bytes transferred.",
+	MetricFrames:      "Frames transferred.",
+	MetricTimeouts:    "Reads that timed out.",
+	MetricErrors:      "Failed operations.",
+	MetricReconnects:  "Reconnects.",
+	MetricSlipErrors:  "SLIP decoding errors.",
+	MetricTransaction: "Time from a write to the end of the following read.",
+	MetricTurnaround:  "Time from the end of transmission to the RS-485 receiver enabled.",
+}
+
+// Collector receives metrics. labels are name, value pairs.
+type Collector interface {
+	// Add increments the counter name by delta.
+	Add(name string, delta float64, labels ...string)
+	// Observe adds a value to the histogram name.
+	Observe(name string, value float64, labels ...string)
+}
+
+// DefaultBuckets are the histogram buckets of Metrics, in seconds.
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// portMetrics is embedded in transports to provide SetMetrics.
+type portMetrics struct {
+	metrics      Collector
+	metrics_port string
+}
+
+// SetMetrics sets the collector of the transport metrics. port is the
+// value of the "port" label.
+func (m *portMetrics) SetMetrics(c Collector, port string) {
+	m.metrics = c
+	m.metrics_port = port
+}
+
+func (m *portMetrics) count(name string, delta float64, labels ...string) {
+	if m.metrics == nil {
+		return
+	}
+	m.metrics.Add(name, delta, append([]string{"port", m.metrics_port}, labels...)...)
+}
+
+func (m *portMetrics) observe(name string, d time.Duration) {
+	if m.metrics == nil {
+		return
+	}
+	if d < 0 {
+		d = 0
+	}
+	m.metrics.Observe(name, d.Seconds(), "port", m.metrics_port)
+}
+
+// countErr counts err of op as a timeout or an error. Wrapped
+// ErrTimeout and net.Error timeouts count as timeouts.
+func (m *portMetrics) countErr(op string, err error) {
+	var ne net.Error
+	if errors.Is(err, ErrTimeout) || (errors.As(err, &ne) && ne.Timeout()) {
+		m.count(MetricTimeouts, 1)
+	} else if err != nil {
+		m.count(MetricErrors, 1, "op", op)
+	}
+}
+
+type metricKey struct {
+	name   string
+	labels string // отсортированные пары в формате Prometheus: a="1",b="2"
+}
+
+type histogram struct {
+	counts []uint64 // по границам buckets
+	count  uint64
+	sum    float64
+}
+
+// Metrics is an in-memory Collector exposing metrics in the Prometheus
+// text format.
+type Metrics struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[metricKey]float64
+	histograms map[metricKey]*histogram
+}
+
+// NewMetrics creates a collector with histogram buckets (DefaultBuckets
+// if nil).
+func NewMetrics(buckets []float64) *Metrics {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Metrics{
+		buckets:    b,
+		counters:   map[metricKey]float64{},
+		histograms: map[metricKey]*histogram{},
+	}
+}
+
+// promEscaper escapes a label value for the text exposition format,
+// which allows only \\, \" and \n escapes.
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabels(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+promEscaper.Replace(labels[i+1])+`"`)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *Metrics) Add(name string, delta float64, labels ...string) {
+	k := metricKey{name, promLabels(labels)}
+	m.mu.Lock()
+	m.counters[k] += delta
+	m.mu.Unlock()
+}
+
+func (m *Metrics) Observe(name string, value float64, labels ...string) {
+	k := metricKey{name, promLabels(labels)}
+	m.mu.Lock()
+	h := m.histograms[k]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.histograms[k] = h
+	}
+	for i, b := range m.buckets {
+		if value <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+	m.mu.Unlock()
+}
+
+// Counter returns the value of a counter.
+func (m *Metrics) Counter(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[metricKey{name, promLabels(labels)}]
+}
+
+// HistogramCount returns the number of observations of a histogram.
+func (m *Metrics) HistogramCount(name string, labels ...string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h := m.histograms[metricKey{name, promLabels(labels)}]; h != nil {
+		return h.count
+	}
+	return 0
+}
+
+func sortedKeys[V any](m map[metricKey]V) []metricKey {
+	keys := make([]metricKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].labels < keys[j].labels
+	})
+	return keys
+}
+
+func promValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func promSeries(name, labels, extra string) string {
+	switch {
+	case labels == "" && extra == "":
+		return name
+	case labels == "":
+		return name + "{" + extra + "}"
+	case extra == "":
+		return name + "{" + labels + "}"
+	}
+	return name + "{" + labels + "," + extra + "}"
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	header := func(name, typ string) {
+		if help, ok := metricHelp[name]; ok {
+			fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, typ)
+	}
+	last := ""
+	for _, k := range sortedKeys(m.counters) {
+		if k.name != last {
+			header(k.name, "counter")
+			last = k.name
+		}
+		fmt.Fprintf(bw, "%s %s\n", promSeries(k.name, k.labels, ""), promValue(m.counters[k]))
+	}
+	last = ""
+	for _, k := range sortedKeys(m.histograms) {
+		if k.name != last {
+			header(k.name, "histogram")
+			last = k.name
+		}
+		h := m.histograms[k]
+		for i, b := range m.buckets {
+			le := `le="` + promValue(b) + `"`
+			fmt.Fprintf(bw, "%s %d\n", promSeries(k.name+"_bucket", k.labels, le), h.counts[i])
+		}
+		fmt.Fprintf(bw, "%s %d\n", promSeries(k.name+"_bucket", k.labels, `le="+Inf"`), h.count)
+		fmt.Fprintf(bw, "%s %s\n", promSeries(k.name+"_sum", k.labels, ""), promValue(h.sum))
+		fmt.Fprintf(bw, "%s %d\n", promSeries(k.name+"_count", k.labels, ""), h.count)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+// ExpvarCollector publishes metrics as an expvar.Map. Counters are
+// floats keyed by `name{labels}`, histograms are maps with count and sum.
+type ExpvarCollector struct {
+	m  *expvar.Map
+	mu sync.Mutex
+}
+
+// NewExpvarCollector publishes the map under name, or reuses the map
+// already published under it.
+func NewExpvarCollector(name string) *ExpvarCollector {
+	if v, ok := expvar.Get(name).(*expvar.Map); ok {
+		return &ExpvarCollector{m: v}
+	}
+	return &ExpvarCollector{m: expvar.NewMap(name)}
+}
+
+// Map returns the published map.
+func (e *ExpvarCollector) Map() *expvar.Map {
+	return e.m
+}
+
+func (e *ExpvarCollector) Add(name string, delta float64, labels ...string) {
+	e.m.AddFloat(promSeries(name, promLabels(labels), ""), delta)
+}
+
+func (e *ExpvarCollector) Observe(name string, value float64, labels ...string) {
+	key := promSeries(name, promLabels(labels), "")
+	e.mu.Lock()
+	h, ok := e.m.Get(key).(*expvar.Map)
+	if !ok {
+		h = new(expvar.Map).Init()
+		e.m.Set(key, h)
+	}
+	e.mu.Unlock()
+	h.Add("count", 1)
+	h.AddFloat("sum", value)
+}
@@ -0,0 +1,181 @@
+package serialport
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsPrometheus(t *testing.T) {
+	m := NewMetrics([]float64{0.01, 0.001})
+	m.Add(MetricBytes, 3, "port", "ttyS0", "dir", "write")
+	m.Add(MetricBytes, 2, "dir", "write", "port", "ttyS0")
+	m.Add(MetricTimeouts, 1, "port", `a"b`)
+	m.Add(MetricErrors, 1, "port", "порт\\1\n")
+	m.Observe(MetricTransaction, 0.005, "port", "ttyS0")
+	m.Observe(MetricTransaction, 0.5, "port", "ttyS0")
+
+	if v := m.Counter(MetricBytes, "port", "ttyS0", "dir", "write"); v != 5 {
+		t.Errorf("counter %v", v)
+	}
+	if c := m.HistogramCount(MetricTransaction, "port", "ttyS0"); c != 2 {
+		t.Errorf("histogram count %d", c)
+	}
+	var out bytes.Buffer
+	if err := m.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE serialport_bytes_total counter",
+		`serialport_bytes_total{dir="write",port="ttyS0"} 5`,
+		`serialport_timeouts_total{port="a\"b"} 1`,
+		`serialport_errors_total{port="порт\\1\n"} 1`,
+		"# TYPE serialport_transaction_seconds histogram",
+		`serialport_transaction_seconds_bucket{port="ttyS0",le="0.001"} 0`,
+		`serialport_transaction_seconds_bucket{port="ttyS0",le="0.01"} 1`,
+		`serialport_transaction_seconds_bucket{port="ttyS0",le="+Inf"} 2`,
+		`serialport_transaction_seconds_sum{port="ttyS0"} 0.505`,
+		`serialport_transaction_seconds_count{port="ttyS0"} 2`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("нет строки %q в\n%s", line, out.String())
+		}
+	}
+}
+
+func TestCountErrTimeout(t *testing.T) {
+	m := NewMetrics(nil)
+	var pm portMetrics
+	pm.SetMetrics(m, "p")
+	pm.countErr("read", fmt.Errorf("rfc2217: %w", ErrTimeout))
+	pm.countErr("read", os.ErrDeadlineExceeded)
+	pm.countErr("read", io.EOF)
+	if v := m.Counter(MetricTimeouts, "port", "p"); v != 2 {
+		t.Errorf("таймауты %v", v)
+	}
+	if v := m.Counter(MetricErrors, "port", "p", "op", "read"); v != 1 {
+		t.Errorf("ошибки %v", v)
+	}
+}
+
+func TestExpvarCollector(t *testing.T) {
+	e := NewExpvarCollector("serialport_test")
+	if NewExpvarCollector("serialport_test").Map() != e.Map() {
+		t.Error("повторная публикация")
+	}
+	e.Add(MetricFrames, 2, "port", "p", "dir", "read")
+	e.Observe(MetricTurnaround, 0.25, "port", "p")
+	e.Observe(MetricTurnaround, 0.25, "port", "p")
+	if v := e.Map().Get(`serialport_frames_total{dir="read",port="p"}`); v == nil || v.String() != "2" {
+		t.Errorf("counter %v", v)
+	}
+	h, _ := e.Map().Get(`serialport_rs485_turnaround_seconds{port="p"}`).(*expvar.Map)
+	if h == nil || h.Get("count").String() != "2" || h.Get("sum").String() != "0.5" {
+		t.Errorf("histogram %v", h)
+	}
+}
+
+func TestSlipMetrics(t *testing.T) {
+	m := NewMetrics(nil)
+	frames := 0
+	r := NewSlipReadByte(4, func(buf []byte, size int) { frames++ })
+	r.SetMetrics(m, "slip0")
+	for _, c := range []byte{0xC0, 1, 2, 0xC0, 0xDB, 0x00, 1, 2, 3, 4, 5, 0xC0} {
+		r.Readbyte(c)
+	}
+	r.CrcMismatch()
+	for kind, want := range map[string]float64{"escape": 1, "overflow": 1, "crc": 1} {
+		if v := m.Counter(MetricSlipErrors, "port", "slip0", "kind", kind); v != want {
+			t.Errorf("%s: %v", kind, v)
+		}
+	}
+	if v := m.Counter(MetricFrames, "port", "slip0", "dir", "read"); v != float64(frames) || frames != 1 {
+		t.Errorf("frames %v, callback %d", v, frames)
+	}
+
+	var written []byte
+	mock := MockSlip{
+		MockWrite: func(b []byte) (int, error) { written = append(written, b...); return len(b), nil },
+		MockRead: func(b []byte, e int) (int, error) {
+			n := copy(b, written)
+			written = nil
+			if n == 0 {
+				return 0, ErrTimeout
+			}
+			return n, nil
+		},
+	}
+	var s Slip
+	s.SetMetrics(m, "slip1")
+	s.SlipWrite(&mock, []byte{1, 0xC0, 2})
+	buf := make([]byte, 16)
+	s.SlipRead(&mock, buf, 0) // байт FLUSH до первого END читается отдельным кадром
+	if n, _, err := s.SlipRead(&mock, buf, 0); err != nil || !bytes.Equal(buf[:n], []byte{1, 0xC0, 2}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	s.SlipRead(&mock, buf, 0)
+	if v := m.Counter(MetricFrames, "port", "slip1", "dir", "write"); v != 1 {
+		t.Errorf("write frames %v", v)
+	}
+	if v := m.Counter(MetricFrames, "port", "slip1", "dir", "read"); v != 2 {
+		t.Errorf("read frames %v", v)
+	}
+	if v := m.Counter(MetricTimeouts, "port", "slip1"); v != 1 {
+		t.Errorf("timeouts %v", v)
+	}
+}
+
+func TestSerialPortMetrics(t *testing.T) {
+	master, err := NewSerialPortPty(50 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	m := NewMetrics(nil)
+	master.SetMetrics(m, "pty")
+	master.Write([]byte{1, 2, 3})
+	buf := make([]byte, 16)
+	if n, err := slave.Read(buf); err != nil || n != 3 {
+		t.Fatalf("slave read %d %v", n, err)
+	}
+	slave.Write([]byte{4, 5})
+	if _, err := master.Read(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.Read(buf, 0); err != ErrTimeout {
+		t.Fatalf("ожидается ErrTimeout, получено %v", err)
+	}
+	master.Reconnect()
+
+	for _, c := range []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{MetricBytes, []string{"port", "pty", "dir", "write"}, 3},
+		{MetricBytes, []string{"port", "pty", "dir", "read"}, 2},
+		{MetricTimeouts, []string{"port", "pty"}, 1},
+		{MetricReconnects, []string{"port", "pty"}, 1},
+	} {
+		if v := m.Counter(c.name, c.labels...); v != c.want {
+			t.Errorf("%s %v: %v, ожидалось %v", c.name, c.labels, v, c.want)
+		}
+	}
+	if c := m.HistogramCount(MetricTransaction, "port", "pty"); c != 1 {
+		t.Errorf("transaction count %d", c)
+	}
+}
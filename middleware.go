@@ -0,0 +1,167 @@
+package serialport
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Op is the operation of a Call.
+type Op byte
+
+const (
+	OpWrite Op = iota + 1
+	OpRead
+	OpConnect
+	OpClose
+	OpReconnect
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpWrite:
+		return "write"
+	case OpRead:
+		return "read"
+	case OpConnect:
+		return "connect"
+	case OpClose:
+		return "close"
+	case OpReconnect:
+		return "reconnect"
+	}
+	return fmt.Sprintf("Op(%d)", byte(o))
+}
+
+// Call is one operation passing through a middleware chain.
+type Call struct {
+	Op  Op
+	Seq uint64    // номер вызова в цепочке, начиная с 1
+	At  time.Time // время начала вызова
+
+	// Buf is the data to send for OpWrite, a middleware may replace it
+	// before calling next. For OpRead it is the caller's buffer, the
+	// result is in Buf[:n] after next returns and may be changed in place.
+	Buf []byte
+
+	// EstimatedByte is the estimated_byte hint of OpRead.
+	EstimatedByte int
+
+	values map[any]any
+}
+
+// Set stores a value for the following middlewares of the same call.
+func (c *Call) Set(key, value any) {
+	if c.values == nil {
+		c.values = map[any]any{}
+	}
+	c.values[key] = value
+}
+
+// Value returns a value stored by Set.
+func (c *Call) Value(key any) any {
+	return c.values[key]
+}
+
+// Handler performs a call. For OpWrite and OpRead n is the byte count,
+// for other operations it is 0.
+type Handler func(c *Call) (n int, err error)
+
+// Middleware wraps the next handler of the chain.
+type Middleware func(next Handler) Handler
+
+// Chain is a transport wrapped into middlewares. The first middleware is
+// the outermost one: it sees a Write buffer first and a Read result last.
+// Is_connect is passed to the transport directly.
+type Chain struct {
+	InterfaceSerial
+
+	handler Handler
+	seq     atomic.Uint64
+}
+
+// NewChain wraps s into mw.
+func NewChain(s InterfaceSerial, mw ...Middleware) *Chain {
+	c := &Chain{InterfaceSerial: s}
+	h := c.call
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	c.handler = h
+	return c
+}
+
+// Unwrap returns the wrapped transport.
+func (c *Chain) Unwrap() InterfaceSerial {
+	return c.InterfaceSerial
+}
+
+func (c *Chain) call(call *Call) (int, error) {
+	switch call.Op {
+	case OpWrite:
+		return c.InterfaceSerial.Write(call.Buf)
+	case OpRead:
+		return c.InterfaceSerial.Read(call.Buf, call.EstimatedByte)
+	case OpConnect:
+		return 0, c.InterfaceSerial.Connect()
+	case OpClose:
+		return 0, c.InterfaceSerial.Close()
+	case OpReconnect:
+		return 0, c.InterfaceSerial.Reconnect()
+	}
+	return 0, fmt.Errorf("unknown op %s", call.Op)
+}
+
+func (c *Chain) newCall(op Op, buf []byte, estimated_byte int) *Call {
+	return &Call{Op: op, Seq: c.seq.Add(1), At: time.Now(), Buf: buf, EstimatedByte: estimated_byte}
+}
+
+func (c *Chain) do(op Op, buf []byte, estimated_byte int) (int, error) {
+	return c.handler(c.newCall(op, buf, estimated_byte))
+}
+
+// Write returns the count of b written. If a middleware replaced Buf,
+// the count of the replacement is mapped back: all of b when it was
+// written completely, else at most len(b).
+func (c *Chain) Write(b []byte) (int, error) {
+	call := c.newCall(OpWrite, b, 0)
+	n, err := c.handler(call)
+	replaced := len(call.Buf) != len(b) || (len(b) > 0 && &call.Buf[0] != &b[0])
+	if replaced && err == nil && n == len(call.Buf) {
+		n = len(b)
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	return n, err
+}
+
+func (c *Chain) Read(b []byte, estimated_byte int) (int, error) {
+	return c.do(OpRead, b, estimated_byte)
+}
+
+func (c *Chain) Connect() error {
+	_, err := c.do(OpConnect, nil, 0)
+	return err
+}
+
+func (c *Chain) Close() error {
+	_, err := c.do(OpClose, nil, 0)
+	return err
+}
+
+func (c *Chain) Reconnect() error {
+	_, err := c.do(OpReconnect, nil, 0)
+	return err
+}
+
+// Observe returns a middleware calling f after every call with its result.
+func Observe(f func(c *Call, n int, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Call) (int, error) {
+			n, err := next(c)
+			f(c, n, err)
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package serialport
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	ln := tcpEchoServer(t, 64)
+	defer ln.Close()
+	dev, _ := NewSerialTcp(ln.Addr().String(), 200*time.Millisecond)
+
+	order := []string{}
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Call) (int, error) {
+				order = append(order, name+">"+c.Op.String())
+				n, err := next(c)
+				order = append(order, name+"<"+c.Op.String())
+				return n, err
+			}
+		}
+	}
+	// инверсия данных на записи и обратная инверсия на чтении
+	invert := func(next Handler) Handler {
+		return func(c *Call) (int, error) {
+			if c.Op == OpWrite {
+				b := make([]byte, len(c.Buf))
+				for i := range c.Buf {
+					b[i] = ^c.Buf[i]
+				}
+				c.Buf = b
+			}
+			n, err := next(c)
+			if c.Op == OpRead {
+				for i := range c.Buf[:n] {
+					c.Buf[i] = ^c.Buf[i]
+				}
+			}
+			return n, err
+		}
+	}
+	var written []byte
+	var hint int
+	var seqs []uint64
+	spy := Observe(func(c *Call, n int, err error) {
+		seqs = append(seqs, c.Seq)
+		switch c.Op {
+		case OpWrite:
+			written = append([]byte(nil), c.Buf...)
+		case OpRead:
+			hint = c.EstimatedByte
+		}
+	})
+
+	ch := NewChain(dev, trace("a"), trace("b"), invert, spy)
+	if err := ch.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if !ch.Is_connect() {
+		t.Fatal("нет подключения")
+	}
+	req := []byte{0x01, 0x02, 0x03}
+	if n, err := ch.Write(req); n != 3 || err != nil {
+		t.Fatalf("write %d %v", n, err)
+	}
+	if !bytes.Equal(written, []byte{0xFE, 0xFD, 0xFC}) {
+		t.Errorf("в транспорт записано %X", written)
+	}
+	buf := make([]byte, 16)
+	n, err := ch.Read(buf, 3)
+	if err != nil || !bytes.Equal(buf[:n], req) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	if hint != 3 {
+		t.Errorf("estimated_byte %d", hint)
+	}
+	ch.Close()
+	if ch.Is_connect() {
+		t.Error("транспорт не закрыт")
+	}
+
+	want := []string{
+		"a>connect", "b>connect", "b<connect", "a<connect",
+		"a>write", "b>write", "b<write", "a<write",
+		"a>read", "b>read", "b<read", "a<read",
+		"a>close", "b>close", "b<close", "a<close",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("порядок вызовов %v", order)
+	}
+	if !reflect.DeepEqual(seqs, []uint64{1, 2, 3, 4}) {
+		t.Errorf("номера вызовов %v", seqs)
+	}
+	if ch.Unwrap() != dev {
+		t.Error("Unwrap")
+	}
+}
+
+func TestCallValues(t *testing.T) {
+	set := func(next Handler) Handler {
+		return func(c *Call) (int, error) {
+			c.Set("start", 42)
+			return next(c)
+		}
+	}
+	var got any
+	get := Observe(func(c *Call, n int, err error) { got = c.Value("start") })
+	ch := NewChain(NewReplay(nil, 0, time.Millisecond), set, get)
+	ch.Connect()
+	if got != 42 {
+		t.Errorf("значение вызова %v", got)
+	}
+	var empty Call
+	if empty.Value("x") != nil {
+		t.Error("значение пустого вызова")
+	}
+}
+
+type countWriter struct {
+	InterfaceSerial
+	written []byte
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.written = append(w.written, b...)
+	return len(b), nil
+}
+
+func TestChainWriteCount(t *testing.T) {
+	// кадрирование: в транспорт уходит больше байт, чем передано
+	frame := func(next Handler) Handler {
+		return func(c *Call) (int, error) {
+			c.Buf = append([]byte{0x7E}, append(c.Buf, 0x7E)...)
+			return next(c)
+		}
+	}
+	w := &countWriter{}
+	if n, err := NewChain(w, frame).Write([]byte{1, 2}); n != 2 || err != nil || len(w.written) != 4 {
+		t.Errorf("write %d %v, записано %X", n, err, w.written)
+	}
+	// сжатие: в транспорт уходит меньше
+	shrink := func(next Handler) Handler {
+		return func(c *Call) (int, error) {
+			c.Buf = c.Buf[:1:1]
+			return next(c)
+		}
+	}
+	if n, err := NewChain(w, shrink).Write([]byte{1, 2, 3}); n != 3 || err != nil {
+		t.Errorf("write %d %v", n, err)
+	}
+}
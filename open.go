@@ -0,0 +1,249 @@
+package serialport
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opener creates a transport from a parsed connection URL.
+// The returned transport is not connected yet.
+type Opener func(u *url.URL) (InterfaceSerial, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = map[string]Opener{}
+)
+
+func init() {
+	RegisterScheme("serial", openSerialURL)
+	RegisterScheme("udp", openUdpURL)
+	RegisterScheme("pty", openPtyURL)
+}
+
+// RegisterScheme makes a transport available to NewFromURL and Open under
+// the given URL scheme. Registering a scheme again replaces the previous Opener.
+func RegisterScheme(scheme string, f Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	if f == nil {
+		delete(openers, strings.ToLower(scheme))
+		return
+	}
+	openers[strings.ToLower(scheme)] = f
+}
+
+// NewFromURL creates a transport described by rawurl without connecting it.
+//
+// Supported out of the box:
+//
+//	serial:///dev/ttyUSB0?baud=9600&size=8&parity=E&stop=1&rs=485&de=rts&timeout=500ms
+//	  (rs: 232, 422, 485 or 485-4w; de: RS-485 driver enable line rts,
+//	  dtr or rts,dtr, de_active_low=1 to invert. Without de the RS-485
+//	  modes need an adapter with automatic direction control; GPIO
+//	  controls are passed to NewSerialPortStty.)
+//	udp://10.0.0.5:4001?listen=4001&timeout=500ms
+//	tcp://10.0.0.5:4001?timeout=500ms&keepalive=30s
+//	rfc2217://10.0.0.5:4001?baud=9600&parity=E&timeout=500ms
+//	unix:///tmp/vm-serial.sock?timeout=500ms&listen=1
+//	pty://?timeout=100ms
+func NewFromURL(rawurl string) (InterfaceSerial, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	openersMu.RLock()
+	f, ok := openers[strings.ToLower(u.Scheme)]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown scheme %q", u.Scheme)
+	}
+	return f(u)
+}
+
+// Open creates the transport described by rawurl and connects it.
+func Open(rawurl string) (InterfaceSerial, error) {
+	s, err := NewFromURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+const defaultURLTimeout = time.Second
+
+func urlDuration(q url.Values, key string, def time.Duration) (time.Duration, error) {
+	v := q.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	if ms, err := strconv.Atoi(v); err == nil {
+		// число без единиц - миллисекунды
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s %q: %w", key, v, err)
+	}
+	return d, nil
+}
+
+func urlInt(q url.Values, key string, def int) (int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s %q: %w", key, v, err)
+	}
+	return i, nil
+}
+
+// ParseParity converts N, O, E, M or S (any case, or the full word) to Parity.
+func ParseParity(v string) (Parity, error) {
+	switch strings.ToUpper(v) {
+	case "", "N", "NONE":
+		return ParityNone, nil
+	case "O", "ODD":
+		return ParityOdd, nil
+	case "E", "EVEN":
+		return ParityEven, nil
+	case "M", "MARK":
+		return ParityMark, nil
+	case "S", "SPACE":
+		return ParitySpace, nil
+	}
+	return 0, &ConfigError{Field: "Parity", Value: v, Err: ErrBadParity}
+}
+
+// ParseStopBits converts "1", "1.5" or "2" to StopBits.
+func ParseStopBits(v string) (StopBits, error) {
+	switch v {
+	case "", "1":
+		return Stop1, nil
+	case "1.5":
+		return Stop1Half, nil
+	case "2":
+		return Stop2, nil
+	}
+	return 0, &ConfigError{Field: "StopBits", Value: v, Err: ErrBadStopBits}
+}
+
+func openSerialURL(u *url.URL) (InterfaceSerial, error) {
+	device := u.Path
+	if device == "" {
+		device = u.Opaque
+	}
+	if device == "" {
+		return nil, fmt.Errorf("serial url: no device")
+	}
+	q := u.Query()
+	baud, err := urlInt(q, "baud", 9600)
+	if err != nil {
+		return nil, err
+	}
+	size, err := urlInt(q, "size", DefaultSize)
+	if err != nil {
+		return nil, err
+	}
+	if size < 5 || size > 8 {
+		return nil, &ConfigError{Field: "Size", Value: size, Err: ErrBadSize}
+	}
+	parity, err := ParseParity(q.Get("parity"))
+	if err != nil {
+		return nil, err
+	}
+	stop, err := ParseStopBits(q.Get("stop"))
+	if err != nil {
+		return nil, err
+	}
+	if stop == Stop1Half {
+		// termios не умеет 1.5 стоп-бита
+		return nil, &ConfigError{Field: "StopBits", Value: q.Get("stop"), Err: ErrBadStopBits}
+	}
+	typeRS, err := ParseLineMode(q.Get("rs"))
+	if err != nil {
+		return nil, err
+	}
+	ctrlEn, err := urlCtrlEn(q)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := urlDuration(q, "timeout", defaultURLTimeout)
+	if err != nil {
+		return nil, err
+	}
+	charGap, err := urlDuration(q, "char_gap", 0)
+	if err != nil {
+		return nil, err
+	}
+	frameGap, err := urlDuration(q, "frame_gap", 0)
+	if err != nil {
+		return nil, err
+	}
+	if ctrlEn != nil && typeRS != RS485 && typeRS != RS485FourWire {
+		return nil, &ConfigError{Field: "de", Value: q.Get("de"), Err: ErrBadLineMode}
+	}
+	s, err := NewSerialPortStty(device, baud, wait, typeRS, ctrlEn)
+	if err != nil {
+		return nil, err
+	}
+	s.SetFraming(byte(size), parity, stop)
+	s.SetTxPacing(charGap, frameGap)
+	return s, nil
+}
+
+// urlCtrlEn creates the RS-485 direction control of the de parameter,
+// nil if it is absent.
+func urlCtrlEn(q url.Values) (ICtrlTxRxEn, error) {
+	de := strings.ToLower(q.Get("de"))
+	if de == "" || de == "none" {
+		return nil, nil
+	}
+	activeLow := q.Get("de_active_low") == "1"
+	switch de {
+	case "rts":
+		return NewCtrlModemLines(true, false, activeLow)
+	case "dtr":
+		return NewCtrlModemLines(false, true, activeLow)
+	case "rts,dtr":
+		return NewCtrlModemLines(true, true, activeLow)
+	}
+	return nil, &ConfigError{Field: "de", Value: de, Err: ErrModemLine}
+}
+
+func openUdpURL(u *url.URL) (InterfaceSerial, error) {
+	host := u.Hostname()
+	dest, err := strconv.Atoi(u.Port())
+	if err != nil || dest <= 0 || dest > 0xFFFF {
+		return nil, fmt.Errorf("udp url: bad port %q", u.Port())
+	}
+	q := u.Query()
+	listen, err := urlInt(q, "listen", dest)
+	if err != nil {
+		return nil, err
+	}
+	if listen < 0 || listen > 0xFFFF {
+		return nil, fmt.Errorf("udp url: bad listen port %d", listen)
+	}
+	wait, err := urlDuration(q, "timeout", defaultURLTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewSerialPortUdp(host, uint16(listen), uint16(dest), wait)
+}
+
+func openPtyURL(u *url.URL) (InterfaceSerial, error) {
+	wait, err := urlDuration(u.Query(), "timeout", defaultURLTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewSerialPortPty(wait)
+}
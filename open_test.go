@@ -0,0 +1,111 @@
+package serialport
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNewFromURL(t *testing.T) {
+	tt := []struct {
+		caseName string
+		url      string
+		err      bool
+	}{
+		{"serial", "serial:///dev/ttyUSB0?baud=9600&parity=E&stop=1&rs=485", false},
+		{"serial gaps", "serial:///dev/ttyS1?baud=19200&char_gap=1ms&frame_gap=2", false},
+		{"serial no device", "serial://?baud=9600", true},
+		{"serial bad parity", "serial:///dev/ttyS0?parity=X", true},
+		{"serial bad stop", "serial:///dev/ttyS0?stop=3", true},
+		{"serial bad size", "serial:///dev/ttyS0?size=9", true},
+		{"serial stop 1.5", "serial:///dev/ttyS0?stop=1.5", true},
+		{"serial de", "serial:///dev/ttyS0?rs=485&de=rts&de_active_low=1", false},
+		{"serial bad de", "serial:///dev/ttyS0?rs=485&de=cts", true},
+		{"serial de rs232", "serial:///dev/ttyS0?de=rts", true},
+		{"serial bad timeout", "serial:///dev/ttyS0?timeout=abc", true},
+		{"udp", "udp://10.0.0.5:4001?listen=4001&timeout=500ms", false},
+		{"udp no port", "udp://10.0.0.5", true},
+		{"pty", "pty://", false},
+		{"unknown", "foo://bar", true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.caseName, func(t *testing.T) {
+			s, err := NewFromURL(tc.url)
+			if tc.err && err == nil {
+				t.Errorf("ожидается ошибка для %s", tc.url)
+			}
+			if !tc.err && (err != nil || s == nil) {
+				t.Errorf("%s: %v", tc.url, err)
+			}
+		})
+	}
+}
+
+func TestNewFromURLSerialConfig(t *testing.T) {
+	s, err := NewFromURL("serial:///dev/ttyUSB0?baud=19200&size=7&parity=O&stop=2&rs=485&timeout=250ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := s.(*SerialPort)
+	c := sp.config_stty
+	if c.device != "/dev/ttyUSB0" || c.baud != 19200 || c.size != 7 || c.parity != ParityOdd ||
+		c.stopBits != Stop2 || c.typeRS != 485 || c.wait != 250*time.Millisecond {
+		t.Errorf("config %+v", c)
+	}
+}
+
+func TestNewFromURLSerialCtrl(t *testing.T) {
+	s, err := NewFromURL("serial:///dev/ttyUSB0?rs=485&de=rts,dtr&de_active_low=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := s.(*SerialPort).ctrlEn.(*CtrlModemLines)
+	if !ok || c.lines != unix.TIOCM_RTS|unix.TIOCM_DTR || !c.activeLow {
+		t.Errorf("управление направлением %+v", s.(*SerialPort).ctrlEn)
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	errTest := errors.New("test")
+	RegisterScheme("Test", func(u *url.URL) (InterfaceSerial, error) {
+		if u.Host != "dev" {
+			t.Errorf("host %q", u.Host)
+		}
+		return nil, errTest
+	})
+	defer RegisterScheme("test", nil)
+	if _, err := NewFromURL("test://dev"); err != errTest {
+		t.Errorf("err %v", err)
+	}
+}
+
+func TestOpenPty(t *testing.T) {
+	s, err := Open("pty://?timeout=500ms")
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer s.Close()
+	master := s.(*SerialPort)
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	msg := []byte{0x01, 0x03, 0xC0, 0x0A}
+	if _, err := slave.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := s.Read(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], msg) {
+		t.Errorf("read %X, expected %X", buf[:n], msg)
+	}
+}
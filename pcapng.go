@@ -0,0 +1,275 @@
+package serialport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Link types of pcapng interfaces.
+const (
+	LinkTypeSLIP  = 8   // SLIP с 16 байтным заголовком направления
+	LinkTypeRaw   = 101 // IPv4/IPv6 без канального заголовка
+	LinkTypeUser0 = 147 // DLT_USER0, сырые данные порта
+	LinkTypeUser1 = 148 // DLT_USER1, прикладные SLIP кадры
+)
+
+const (
+	pcapngSHB = 0x0A0D0D0A
+	pcapngIDB = 0x00000001
+	pcapngEPB = 0x00000006
+
+	pcapngOptEnd     = 0
+	pcapngOptComment = 1
+	pcapngOptIfName  = 2
+	pcapngOptTsResol = 9
+)
+
+// PcapWriter writes a pcapng stream (little endian, nanosecond timestamps).
+type PcapWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	ifaces int
+}
+
+// NewPcapWriter writes the section header and returns the writer.
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	p := &PcapWriter{w: w}
+	body := make([]byte, 0, 16)
+	body = binary.LittleEndian.AppendUint32(body, 0x1A2B3C4D)
+	body = binary.LittleEndian.AppendUint16(body, 1)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint64(body, 0xFFFFFFFFFFFFFFFF) // длина секции неизвестна
+	body = pcapngOption(body, pcapngOptEnd, nil)
+	if err := p.block(pcapngSHB, body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func pcapngPad(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func pcapngOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	return pcapngPad(append(b, value...))
+}
+
+func (p *PcapWriter) block(typ uint32, body []byte) error {
+	total := uint32(12 + len(body))
+	b := make([]byte, 0, total)
+	b = binary.LittleEndian.AppendUint32(b, typ)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	_, err := p.w.Write(b)
+	return err
+}
+
+// AddInterface describes a new interface and returns its id.
+func (p *PcapWriter) AddInterface(name string, linkType uint16) (uint32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	body := make([]byte, 0, 32+len(name))
+	body = binary.LittleEndian.AppendUint16(body, linkType)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0) // snaplen без ограничения
+	if name != "" {
+		body = pcapngOption(body, pcapngOptIfName, []byte(name))
+	}
+	body = pcapngOption(body, pcapngOptTsResol, []byte{9})
+	body = pcapngOption(body, pcapngOptEnd, nil)
+	if err := p.block(pcapngIDB, body); err != nil {
+		return 0, err
+	}
+	id := uint32(p.ifaces)
+	p.ifaces++
+	return id, nil
+}
+
+// WritePacket writes an enhanced packet block with an optional comment.
+func (p *PcapWriter) WritePacket(iface uint32, ts time.Time, data []byte, comment string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if int(iface) >= p.ifaces {
+		return fmt.Errorf("pcapng: unknown interface %d", iface)
+	}
+	ns := uint64(ts.UnixNano())
+	body := make([]byte, 0, 32+len(data)+len(comment))
+	body = binary.LittleEndian.AppendUint32(body, iface)
+	body = binary.LittleEndian.AppendUint32(body, uint32(ns>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(ns))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = pcapngPad(append(body, data...))
+	if comment != "" {
+		body = pcapngOption(body, pcapngOptComment, []byte(comment))
+		body = pcapngOption(body, pcapngOptEnd, nil)
+	}
+	return p.block(pcapngEPB, body)
+}
+
+// slipPcapFrame prepends the LINKTYPE_SLIP header: direction (0 - received,
+// 1 - sent), packet type TYPE_IP and an empty compressed header.
+func slipPcapFrame(dir Direction, frame []byte) []byte {
+	b := make([]byte, 16, 16+len(frame))
+	if dir == DirWrite {
+		b[0] = 1
+	}
+	b[1] = 0x40
+	return append(b, frame...)
+}
+
+// Capture wraps a transport and writes its traffic to pcapng: raw chunks
+// on one interface per direction and, optionally, decoded SLIP frames on
+// another pair of interfaces.
+type Capture struct {
+	InterfaceSerial
+
+	pcap     *PcapWriter
+	raw      [3]uint32 // по Direction
+	slip     [3]uint32
+	slipType uint16
+	decoders [3]*SlipReadByte
+	frames   [3]int
+	mu       sync.Mutex
+}
+
+// NewCapture starts a capture of s named name into w.
+func NewCapture(s InterfaceSerial, w io.Writer, name string) (*Capture, error) {
+	pcap, err := NewPcapWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	c := &Capture{InterfaceSerial: s, pcap: pcap}
+	for _, dir := range []Direction{DirWrite, DirRead} {
+		if c.raw[dir], err = pcap.AddInterface(name+"-"+pcapDirName(dir), LinkTypeUser0); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func pcapDirName(dir Direction) string {
+	if dir == DirWrite {
+		return "tx"
+	}
+	return "rx"
+}
+
+// DecodeSlip additionally emits every SLIP frame of the stream as a
+// separate packet with the given link type: LinkTypeSLIP or LinkTypeRaw
+// for IP over SLIP, LinkTypeUser1 (or any other) for custom payloads.
+func (c *Capture) DecodeSlip(linkType uint16, maxFrame int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slipType = linkType
+	for _, dir := range []Direction{DirWrite, DirRead} {
+		id, err := c.pcap.AddInterface(fmt.Sprintf("slip-%s", pcapDirName(dir)), linkType)
+		if err != nil {
+			return err
+		}
+		c.slip[dir] = id
+		dir := dir
+		c.decoders[dir] = NewSlipReadByte(maxFrame, func(buf []byte, size int) {
+			c.frames[dir]++
+			frame := buf[:size]
+			if c.slipType == LinkTypeSLIP {
+				frame = slipPcapFrame(dir, frame)
+			}
+			c.pcap.WritePacket(c.slip[dir], time.Now(), frame, fmt.Sprintf("slip frame %d", c.frames[dir]))
+		})
+	}
+	return nil
+}
+
+func (c *Capture) capture(dir Direction, data []byte, comment string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pcap.WritePacket(c.raw[dir], time.Now(), data, comment)
+	if d := c.decoders[dir]; d != nil {
+		for _, b := range data {
+			d.Readbyte(b)
+		}
+	}
+}
+
+func (c *Capture) Write(b []byte) (int, error) {
+	n, err := c.InterfaceSerial.Write(b)
+	if n > 0 {
+		c.capture(DirWrite, b[:n], "")
+	}
+	return n, err
+}
+
+func (c *Capture) Read(b []byte, estimated_byte int) (int, error) {
+	n, err := c.InterfaceSerial.Read(b, estimated_byte)
+	if n > 0 {
+		comment := ""
+		if estimated_byte > 0 {
+			comment = fmt.Sprintf("estimated_byte=%d", estimated_byte)
+		}
+		c.capture(DirRead, b[:n], comment)
+	}
+	return n, err
+}
+
+// WriteRecordingPcap converts a recording made by Recorder to pcapng.
+// If slipType is not 0, SLIP frames are decoded as in Capture.DecodeSlip.
+func WriteRecordingPcap(w io.Writer, name string, start time.Time, entries []RecordEntry, slipType uint16) error {
+	pcap, err := NewPcapWriter(w)
+	if err != nil {
+		return err
+	}
+	var raw, slip [3]uint32
+	var decoders [3]*SlipReadByte
+	var ts time.Time
+	var slipErr error
+	for _, dir := range []Direction{DirWrite, DirRead} {
+		if raw[dir], err = pcap.AddInterface(name+"-"+pcapDirName(dir), LinkTypeUser0); err != nil {
+			return err
+		}
+	}
+	if slipType != 0 {
+		for _, dir := range []Direction{DirWrite, DirRead} {
+			if slip[dir], err = pcap.AddInterface("slip-"+pcapDirName(dir), slipType); err != nil {
+				return err
+			}
+			dir := dir
+			decoders[dir] = NewSlipReadByte(BUF_SIZE, func(buf []byte, size int) {
+				frame := buf[:size]
+				if slipType == LinkTypeSLIP {
+					frame = slipPcapFrame(dir, frame)
+				}
+				if slipErr == nil {
+					slipErr = pcap.WritePacket(slip[dir], ts, frame, "")
+				}
+			})
+		}
+	}
+	for _, e := range entries {
+		if e.Dir != DirWrite && e.Dir != DirRead {
+			continue
+		}
+		ts = start.Add(e.Time)
+		if err := pcap.WritePacket(raw[e.Dir], ts, e.Data, ""); err != nil {
+			return err
+		}
+		if d := decoders[e.Dir]; d != nil {
+			for _, b := range e.Data {
+				d.Readbyte(b)
+			}
+		}
+		if slipErr != nil {
+			return slipErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package serialport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+type pcapBlock struct {
+	typ  uint32
+	body []byte
+}
+
+func parsePcapng(t *testing.T, b []byte) []pcapBlock {
+	t.Helper()
+	blocks := []pcapBlock{}
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("обрезанный блок %X", b)
+		}
+		typ := binary.LittleEndian.Uint32(b)
+		total := binary.LittleEndian.Uint32(b[4:])
+		if total%4 != 0 || int(total) > len(b) || binary.LittleEndian.Uint32(b[total-4:]) != total {
+			t.Fatalf("неверная длина блока %d", total)
+		}
+		blocks = append(blocks, pcapBlock{typ, b[8 : total-4]})
+		b = b[total:]
+	}
+	return blocks
+}
+
+func TestPcapWriter(t *testing.T) {
+	var out bytes.Buffer
+	p, err := NewPcapWriter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := p.AddInterface("ttyS0-rx", LinkTypeUser0)
+	ts := time.Unix(1700000000, 123456789)
+	if err := p.WritePacket(id, ts, []byte{0x01, 0x02, 0x03}, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WritePacket(5, ts, nil, ""); err == nil {
+		t.Error("ожидается ошибка неизвестного интерфейса")
+	}
+	blocks := parsePcapng(t, out.Bytes())
+	if len(blocks) != 3 || blocks[0].typ != pcapngSHB || blocks[1].typ != pcapngIDB || blocks[2].typ != pcapngEPB {
+		t.Fatalf("blocks %+v", blocks)
+	}
+	if binary.LittleEndian.Uint32(blocks[0].body) != 0x1A2B3C4D {
+		t.Error("byte order magic")
+	}
+	if binary.LittleEndian.Uint16(blocks[1].body) != LinkTypeUser0 {
+		t.Error("link type")
+	}
+	epb := blocks[2].body
+	ns := uint64(binary.LittleEndian.Uint32(epb[4:]))<<32 | uint64(binary.LittleEndian.Uint32(epb[8:]))
+	if ns != uint64(ts.UnixNano()) {
+		t.Errorf("timestamp %d", ns)
+	}
+	if binary.LittleEndian.Uint32(epb[12:]) != 3 || !bytes.Equal(epb[20:23], []byte{0x01, 0x02, 0x03}) {
+		t.Errorf("packet %X", epb)
+	}
+	if !bytes.Contains(epb, []byte("hello")) {
+		t.Error("нет комментария")
+	}
+}
+
+func TestCaptureSlip(t *testing.T) {
+	ln := tcpEchoServer(t, 3)
+	defer ln.Close()
+	dev, _ := NewSerialTcp(ln.Addr().String(), 200*time.Millisecond)
+	var out bytes.Buffer
+	c, err := NewCapture(dev, &out, "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DecodeSlip(LinkTypeSLIP, 256); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	payload := []byte{0x45, 0x00, COD_END, 0x10}
+	SlipWrite(c, payload)
+	buf := make([]byte, 64)
+	packed := SlipPack(payload)
+	if n, err := c.Read(buf, len(packed)); err != nil || n != len(packed) {
+		t.Fatalf("read %d %v", n, err)
+	}
+
+	blocks := parsePcapng(t, out.Bytes())
+	var ifaces []uint16
+	frames := map[uint32][][]byte{}
+	for _, b := range blocks {
+		switch b.typ {
+		case pcapngIDB:
+			ifaces = append(ifaces, binary.LittleEndian.Uint16(b.body))
+		case pcapngEPB:
+			id := binary.LittleEndian.Uint32(b.body)
+			size := binary.LittleEndian.Uint32(b.body[12:])
+			frames[id] = append(frames[id], b.body[20:20+size])
+		}
+	}
+	if len(ifaces) != 4 || ifaces[0] != LinkTypeUser0 || ifaces[2] != LinkTypeSLIP {
+		t.Fatalf("interfaces %v", ifaces)
+	}
+	// 2 - slip tx, 3 - slip rx
+	for id, dir := range map[uint32]byte{2: 1, 3: 0} {
+		if len(frames[id]) != 1 {
+			t.Fatalf("slip кадры интерфейса %d: %X", id, frames[id])
+		}
+		f := frames[id][0]
+		if f[0] != dir || f[1] != 0x40 || !bytes.Equal(f[16:], payload) {
+			t.Errorf("slip кадр %X", f)
+		}
+	}
+}
+
+func TestWriteRecordingPcap(t *testing.T) {
+	entries := []RecordEntry{
+		{DirWrite, 0, SlipPack([]byte{0x01, 0x02})},
+		{DirRead, 5 * time.Millisecond, []byte{COD_END, 0x03}},
+		{DirRead, 7 * time.Millisecond, []byte{0x04, COD_END}},
+	}
+	var out bytes.Buffer
+	if err := WriteRecordingPcap(&out, "rec", time.Unix(100, 0), entries, LinkTypeUser1); err != nil {
+		t.Fatal(err)
+	}
+	epb := 0
+	for _, b := range parsePcapng(t, out.Bytes()) {
+		if b.typ == pcapngEPB {
+			epb++
+		}
+	}
+	// 3 сырых куска + 2 кадра SLIP
+	if epb != 5 {
+		t.Errorf("packets %d", epb)
+	}
+}
@@ -0,0 +1,155 @@
+package serialport
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// SerialCmd is a transport over the stdin/stdout of a child process,
+// e.g. a device simulator or an emulator started with -serial stdio.
+// Connect starts the process, Close kills it.
+type SerialCmd struct {
+	dataLogger
+	name   string
+	args   []string
+	wait   time.Duration
+	stderr io.Writer
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	exited chan struct{}
+}
+
+// NewSerialCmd creates a transport for the command name with args.
+func NewSerialCmd(wait time.Duration, name string, args ...string) (*SerialCmd, error) {
+	if name == "" {
+		return nil, fmt.Errorf("cmd: empty command")
+	}
+	s := &SerialCmd{name: name, args: args, wait: wait}
+	s.log_port = name
+	return s, nil
+}
+
+// SetStderr sets where the stderr of the process goes (discarded by
+// default). Takes effect on next Connect.
+func (s *SerialCmd) SetStderr(w io.Writer) {
+	s.stderr = w
+}
+
+// Connect starts the process. A running process is killed first.
+func (s *SerialCmd) Connect() error {
+	s.Close()
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return err
+	}
+	cmd := exec.Command(s.name, s.args...)
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	cmd.Stderr = s.stderr
+	err = cmd.Start()
+	// концы процесса в родителе не нужны
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	s.mu.Lock()
+	s.cmd, s.stdin, s.stdout, s.exited = cmd, inW, outR, exited
+	s.mu.Unlock()
+	return nil
+}
+
+// Close kills the process and waits for it to exit.
+func (s *SerialCmd) Close() error {
+	s.mu.Lock()
+	cmd, stdin, stdout, exited := s.cmd, s.stdin, s.stdout, s.exited
+	s.cmd, s.stdin, s.stdout = nil, nil, nil
+	s.mu.Unlock()
+	if cmd == nil {
+		return nil
+	}
+	stdin.Close()
+	select {
+	case <-exited:
+	default:
+		cmd.Process.Kill()
+		<-exited
+	}
+	return stdout.Close()
+}
+
+// Reconnect restarts the process.
+func (s *SerialCmd) Reconnect() error {
+	return s.Connect()
+}
+
+// Is_connect reports whether the process is running.
+func (s *SerialCmd) Is_connect() bool {
+	s.mu.Lock()
+	cmd, exited := s.cmd, s.exited
+	s.mu.Unlock()
+	if cmd == nil {
+		return false
+	}
+	select {
+	case <-exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *SerialCmd) Write(buf []byte) (int, error) {
+	s.mu.Lock()
+	stdin := s.stdin
+	s.mu.Unlock()
+	if stdin == nil {
+		return 0, net.ErrClosed
+	}
+	s.logData(DirWrite, buf)
+	return stdin.Write(buf)
+}
+
+// Read waits up to the read timeout and reads until estimated_byte bytes
+// are received. After the process exits and its output is drained Read
+// returns io.EOF.
+//
+// Unlike SerialPort, Read does not sleep for the estimated character time
+// and does not return after a single read: a pipe has no line timing and
+// a frame may arrive in several chunks, so Read collects them until
+// estimated_byte bytes are received or the timeout expires.
+func (s *SerialCmd) Read(buf []byte, estimated_byte int) (int, error) {
+	s.mu.Lock()
+	stdout := s.stdout
+	s.mu.Unlock()
+	if stdout == nil {
+		return 0, net.ErrClosed
+	}
+	n, err := readStream(stdout, buf, estimated_byte, time.Now().Add(s.wait))
+	if err != nil {
+		return n, err
+	}
+	s.logData(DirRead, buf[:n])
+	return n, nil
+}
@@ -0,0 +1,61 @@
+package serialport
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestSerialCmd(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("нет cat")
+	}
+	s, err := NewSerialCmd(200*time.Millisecond, "cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.Is_connect() {
+		t.Error("Is_connect")
+	}
+
+	msg := []byte{0x01, 0x02, 0x03, 0x04}
+	s.Write(msg)
+	buf := make([]byte, 16)
+	n, err := s.Read(buf, len(msg))
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	if _, err := s.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+
+	s.Close()
+	if s.Is_connect() {
+		t.Error("Is_connect после Close")
+	}
+}
+
+func TestSerialCmdExit(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("нет echo")
+	}
+	s, _ := NewSerialCmd(500*time.Millisecond, "echo", "-n", "ok")
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	buf := make([]byte, 16)
+	n, err := s.Read(buf, 2)
+	if err != nil || string(buf[:n]) != "ok" {
+		t.Errorf("read %q %v", buf[:n], err)
+	}
+	if _, err := s.Read(buf, 0); err != io.EOF {
+		t.Errorf("ожидается EOF, получено %v", err)
+	}
+}
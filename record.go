@@ -0,0 +1,348 @@
+package serialport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Direction of transferred data.
+type Direction byte
+
+const (
+	DirWrite Direction = 1 // к устройству
+	DirRead  Direction = 2 // от устройства
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirWrite:
+		return "write"
+	case DirRead:
+		return "read"
+	}
+	return fmt.Sprintf("Direction(%d)", byte(d))
+}
+
+// RecordEntry is one recorded Write or Read.
+type RecordEntry struct {
+	Dir  Direction
+	Time time.Duration // от начала записи
+	Data []byte
+}
+
+// Recording file format:
+//
+//	header: "SPRC" version(1) start(int64 unix nanoseconds, big endian)
+//	entry:  dir(1) delta(uvarint, microseconds since previous entry) len(uvarint) data
+var recordMagic = []byte("SPRC")
+
+const recordVersion = 1
+
+var ErrBadRecording = errors.New("bad recording format")
+
+// Recorder wraps a transport and records every Write and Read with
+// monotonic timestamps.
+type Recorder struct {
+	InterfaceSerial
+
+	mu    sync.Mutex
+	w     *bufio.Writer
+	start time.Time
+	last  time.Duration
+	err   error
+}
+
+// NewRecorder starts a recording of s into w.
+func NewRecorder(s InterfaceSerial, w io.Writer) (*Recorder, error) {
+	r := &Recorder{InterfaceSerial: s, w: bufio.NewWriter(w), start: time.Now()}
+	var hdr [13]byte
+	copy(hdr[:], recordMagic)
+	hdr[4] = recordVersion
+	binary.BigEndian.PutUint64(hdr[5:], uint64(r.start.UnixNano()))
+	if _, err := r.w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) record(dir Direction, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	// time.Since использует монотонные часы
+	t := time.Since(r.start).Truncate(time.Microsecond)
+	var hdr [1 + 2*binary.MaxVarintLen64]byte
+	hdr[0] = byte(dir)
+	n := 1
+	n += binary.PutUvarint(hdr[n:], uint64((t-r.last)/time.Microsecond))
+	n += binary.PutUvarint(hdr[n:], uint64(len(data)))
+	r.last = t
+	if _, err := r.w.Write(hdr[:n]); err != nil {
+		r.err = err
+		return
+	}
+	if _, err := r.w.Write(data); err != nil {
+		r.err = err
+	}
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	n, err := r.InterfaceSerial.Write(b)
+	if n > 0 {
+		r.record(DirWrite, b[:n])
+	}
+	return n, err
+}
+
+func (r *Recorder) Read(b []byte, estimated_byte int) (int, error) {
+	n, err := r.InterfaceSerial.Read(b, estimated_byte)
+	if n > 0 {
+		r.record(DirRead, b[:n])
+	}
+	return n, err
+}
+
+// Flush writes buffered entries and returns the first recording error.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	return r.w.Flush()
+}
+
+// Close closes the transport and flushes the recording.
+func (r *Recorder) Close() error {
+	err := r.InterfaceSerial.Close()
+	if ferr := r.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// ReadRecording parses a recording written by Recorder. It returns the
+// wall clock start time and the entries.
+func ReadRecording(rd io.Reader) (time.Time, []RecordEntry, error) {
+	br := bufio.NewReader(rd)
+	var hdr [13]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return time.Time{}, nil, ErrBadRecording
+	}
+	if !bytes.Equal(hdr[:4], recordMagic) || hdr[4] != recordVersion {
+		return time.Time{}, nil, ErrBadRecording
+	}
+	start := time.Unix(0, int64(binary.BigEndian.Uint64(hdr[5:])))
+	entries := []RecordEntry{}
+	var t time.Duration
+	for {
+		dir, err := br.ReadByte()
+		if err == io.EOF {
+			return start, entries, nil
+		}
+		if err != nil {
+			return start, entries, err
+		}
+		if Direction(dir) != DirWrite && Direction(dir) != DirRead {
+			return start, entries, ErrBadRecording
+		}
+		delta, err := binary.ReadUvarint(br)
+		if err != nil {
+			return start, entries, ErrBadRecording
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil || size > 1<<24 {
+			return start, entries, ErrBadRecording
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return start, entries, ErrBadRecording
+		}
+		t += time.Duration(delta) * time.Microsecond
+		entries = append(entries, RecordEntry{Dir: Direction(dir), Time: t, Data: data})
+	}
+}
+
+// Replay plays a recording back as a fake device: a Write matching a
+// recorded write schedules the reads recorded after it, with the
+// original timing divided by the speed factor.
+type Replay struct {
+	entries []RecordEntry
+	speed   float64
+	wait    time.Duration
+
+	mu         sync.Mutex
+	open       bool
+	pos        int // следующая запись
+	scheduled  []replayChunk
+	mismatches int
+}
+
+type replayChunk struct {
+	at   time.Time
+	data []byte
+}
+
+// NewReplay creates a replay transport. speed 1 keeps the original
+// timing, 2 plays twice as fast, 0 delivers responses immediately.
+// wait is the read timeout.
+func NewReplay(entries []RecordEntry, speed float64, wait time.Duration) *Replay {
+	return &Replay{entries: entries, speed: speed, wait: wait}
+}
+
+func (r *Replay) scale(d time.Duration) time.Duration {
+	if r.speed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(d) / r.speed)
+}
+
+// schedule queues the reads following position pos relative to base.
+func (r *Replay) schedule(pos int, base time.Duration) {
+	now := time.Now()
+	for ; pos < len(r.entries) && r.entries[pos].Dir == DirRead; pos++ {
+		e := r.entries[pos]
+		c := replayChunk{at: now.Add(r.scale(e.Time - base)), data: e.Data}
+		// ответы перекрывающихся Write держим упорядоченными по времени
+		i := sort.Search(len(r.scheduled), func(i int) bool { return r.scheduled[i].at.After(c.at) })
+		r.scheduled = append(r.scheduled, replayChunk{})
+		copy(r.scheduled[i+1:], r.scheduled[i:])
+		r.scheduled[i] = c
+	}
+	r.pos = pos
+}
+
+// Connect starts the replay from the beginning. Reads recorded before
+// the first write are scheduled right away.
+func (r *Replay) Connect() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.open = true
+	r.scheduled = nil
+	r.schedule(0, 0)
+	return nil
+}
+
+func (r *Replay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.open = false
+	r.scheduled = nil
+	return nil
+}
+
+func (r *Replay) Reconnect() error {
+	return r.Connect()
+}
+
+func (r *Replay) Is_connect() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.open
+}
+
+// Mismatches returns the number of writes not found in the recording.
+func (r *Replay) Mismatches() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mismatches
+}
+
+// Done reports whether all recorded entries have been played.
+func (r *Replay) Done() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos >= len(r.entries) && len(r.scheduled) == 0
+}
+
+func (r *Replay) findWrite(b []byte, from, to int) int {
+	for i := from; i < to; i++ {
+		if r.entries[i].Dir == DirWrite && bytes.Equal(r.entries[i].Data, b) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Write looks for the data among the recorded writes, first after the
+// current position, then from the beginning. Without a match the fake
+// device does not answer.
+func (r *Replay) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.open {
+		return 0, net.ErrClosed
+	}
+	i := r.findWrite(b, r.pos, len(r.entries))
+	if i < 0 {
+		i = r.findWrite(b, 0, r.pos)
+	}
+	if i < 0 {
+		r.mismatches++
+		return len(b), nil
+	}
+	r.schedule(i+1, r.entries[i].Time)
+	return len(b), nil
+}
+
+// Read returns the responses due so far, waiting up to the read timeout
+// until estimated_byte bytes (or any data if estimated_byte <= 0) are due.
+func (r *Replay) Read(buf []byte, estimated_byte int) (int, error) {
+	deadline := time.Now().Add(r.wait)
+	need := estimated_byte
+	if need <= 0 || need > len(buf) {
+		need = 1
+	}
+	for {
+		r.mu.Lock()
+		if !r.open {
+			r.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		now := time.Now()
+		due := 0
+		next := time.Time{}
+		for _, c := range r.scheduled {
+			if c.at.After(now) {
+				next = c.at
+				break
+			}
+			due += len(c.data)
+		}
+		if due >= need || !now.Before(deadline) {
+			n := 0
+			for len(r.scheduled) > 0 && !r.scheduled[0].at.After(now) && n < len(buf) {
+				c := copy(buf[n:], r.scheduled[0].data)
+				n += c
+				if c < len(r.scheduled[0].data) {
+					r.scheduled[0].data = r.scheduled[0].data[c:]
+					break
+				}
+				r.scheduled = r.scheduled[1:]
+			}
+			r.mu.Unlock()
+			if n == 0 {
+				return 0, ErrTimeout
+			}
+			return n, nil
+		}
+		r.mu.Unlock()
+		sleep := time.Until(deadline)
+		if !next.IsZero() && next.Before(deadline) {
+			sleep = time.Until(next)
+		}
+		if sleep > 0 {
+			time.Sleep(sleep)
+		}
+	}
+}
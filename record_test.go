@@ -0,0 +1,105 @@
+package serialport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRecorderReplay(t *testing.T) {
+	ln := tcpEchoServer(t, 4)
+	defer ln.Close()
+	dev, _ := NewSerialTcp(ln.Addr().String(), 200*time.Millisecond)
+	var file bytes.Buffer
+	rec, err := NewRecorder(dev, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	req1 := []byte{0x01, 0x03, 0x00, 0x01}
+	req2 := []byte{0x02, 0x03, 0x00, 0x02, 0x05, 0x06, 0x07, 0x08}
+	buf := make([]byte, 64)
+	for _, req := range [][]byte{req1, req2} {
+		rec.Write(req)
+		if n, err := rec.Read(buf, len(req)); err != nil || !bytes.Equal(buf[:n], req) {
+			t.Fatalf("read %X %v", buf[:n], err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, entries, err := ReadRecording(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 4 || entries[0].Dir != DirWrite || !bytes.Equal(entries[0].Data, req1) || entries[1].Dir != DirRead {
+		t.Fatalf("entries %+v", entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Time < entries[i-1].Time {
+			t.Errorf("время записи %d убывает", i)
+		}
+	}
+
+	replay := NewReplay(entries, 1, 100*time.Millisecond)
+	if err := replay.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	replay.Write(req2)
+	start := time.Now()
+	n, err := replay.Read(buf, len(req2))
+	if err != nil || !bytes.Equal(buf[:n], req2) {
+		t.Errorf("replay read %X %v", buf[:n], err)
+	}
+	// ответ echo сервера частями по 4 байта с паузой 5ms
+	if d := time.Since(start); d < 4*time.Millisecond {
+		t.Errorf("время воспроизведения не соблюдено: %s", d)
+	}
+	replay.Write([]byte{0xFF})
+	if replay.Mismatches() != 1 {
+		t.Errorf("mismatches %d", replay.Mismatches())
+	}
+	if _, err := replay.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+
+	fast := NewReplay(entries, 0, 10*time.Millisecond)
+	fast.Connect()
+	fast.Write(req1)
+	if n, err := fast.Read(buf, len(req1)); err != nil || !bytes.Equal(buf[:n], req1) {
+		t.Errorf("fast replay read %X %v", buf[:n], err)
+	}
+}
+
+func TestReadRecordingBad(t *testing.T) {
+	if _, _, err := ReadRecording(bytes.NewReader([]byte("XXXX"))); err != ErrBadRecording {
+		t.Errorf("err %v", err)
+	}
+	data := append([]byte("SPRC"), recordVersion, 0, 0, 0, 0, 0, 0, 0, 0, byte(DirRead), 0, 5, 1)
+	if _, _, err := ReadRecording(bytes.NewReader(data)); err != ErrBadRecording {
+		t.Errorf("обрезанная запись: err %v", err)
+	}
+}
+
+func TestReplayOverlappingWrites(t *testing.T) {
+	entries := []RecordEntry{
+		{DirWrite, 0, []byte{0x01}},
+		{DirRead, 100 * time.Millisecond, []byte{0xA1}},
+		{DirWrite, 200 * time.Millisecond, []byte{0x02}},
+		{DirRead, 205 * time.Millisecond, []byte{0xA2}},
+	}
+	replay := NewReplay(entries, 1, 50*time.Millisecond)
+	replay.Connect()
+	defer replay.Close()
+	// ответ на 0x01 через 100ms, на 0x02 через 5ms
+	replay.Write([]byte{0x01})
+	replay.Write([]byte{0x02})
+	buf := make([]byte, 4)
+	if n, err := replay.Read(buf, 1); err != nil || !bytes.Equal(buf[:n], []byte{0xA2}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,247 @@
+package serialport
+
+// Telnet and RFC 2217 (Telnet Com Port Control Option) protocol elements
+// shared by the client and the server.
+
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptBinary  = 0
+	telnetOptSGA     = 3
+	telnetOptComPort = 44
+)
+
+// COM-PORT-OPTION commands, client to server. Server responses are +100.
+const (
+	rfc2217Signature         = 0
+	rfc2217SetBaudrate       = 1
+	rfc2217SetDatasize       = 2
+	rfc2217SetParity         = 3
+	rfc2217SetStopsize       = 4
+	rfc2217SetControl        = 5
+	rfc2217NotifyLinestate   = 6
+	rfc2217NotifyModemstate  = 7
+	rfc2217FlowSuspend       = 8
+	rfc2217FlowResume        = 9
+	rfc2217SetLinestateMask  = 10
+	rfc2217SetModemstateMask = 11
+	rfc2217PurgeData         = 12
+
+	rfc2217ServerOffset = 100
+)
+
+// SET-CONTROL values
+const (
+	rfc2217ControlFlowRequest  = 0
+	rfc2217ControlFlowNone     = 1
+	rfc2217ControlFlowXonXoff  = 2
+	rfc2217ControlFlowHardware = 3
+	rfc2217ControlBreakRequest = 4
+	rfc2217ControlBreakOn      = 5
+	rfc2217ControlBreakOff     = 6
+	rfc2217ControlDTRRequest   = 7
+	rfc2217ControlDTROn        = 8
+	rfc2217ControlDTROff       = 9
+	rfc2217ControlRTSRequest   = 10
+	rfc2217ControlRTSOn        = 11
+	rfc2217ControlRTSOff       = 12
+
+	rfc2217ControlInFlowRequest  = 13
+	rfc2217ControlInFlowNone     = 14
+	rfc2217ControlInFlowXonXoff  = 15
+	rfc2217ControlInFlowHardware = 16
+)
+
+// PURGE-DATA values
+const (
+	rfc2217PurgeRx   = 1
+	rfc2217PurgeTx   = 2
+	rfc2217PurgeBoth = 3
+)
+
+// Line state bits reported by NOTIFY-LINESTATE.
+const (
+	LineTimeout     = 0x80
+	LineTxEmpty     = 0x40 // transfer shift register empty
+	LineTxHoldEmpty = 0x20
+	LineBreak       = 0x10
+	LineFraming     = 0x08
+	LineParity      = 0x04
+	LineOverrun     = 0x02
+	LineDataReady   = 0x01
+)
+
+// Modem state bits reported by NOTIFY-MODEMSTATE.
+const (
+	ModemCD        = 0x80
+	ModemRI        = 0x40
+	ModemDSR       = 0x20
+	ModemCTS       = 0x10
+	ModemDeltaCD   = 0x08
+	ModemTrailRI   = 0x04
+	ModemDeltaDSR  = 0x02
+	ModemDeltaCTS  = 0x01
+	modemStateMask = ModemCD | ModemRI | ModemDSR | ModemCTS
+)
+
+func rfc2217ParityCode(p Parity) byte {
+	switch p {
+	case ParityOdd:
+		return 2
+	case ParityEven:
+		return 3
+	case ParityMark:
+		return 4
+	case ParitySpace:
+		return 5
+	}
+	return 1
+}
+
+func rfc2217Parity(v byte) (Parity, bool) {
+	switch v {
+	case 1:
+		return ParityNone, true
+	case 2:
+		return ParityOdd, true
+	case 3:
+		return ParityEven, true
+	case 4:
+		return ParityMark, true
+	case 5:
+		return ParitySpace, true
+	}
+	return 0, false
+}
+
+func rfc2217StopCode(s StopBits) byte {
+	switch s {
+	case Stop2:
+		return 2
+	case Stop1Half:
+		return 3
+	}
+	return 1
+}
+
+func rfc2217StopBits(v byte) (StopBits, bool) {
+	switch v {
+	case 1:
+		return Stop1, true
+	case 2:
+		return Stop2, true
+	case 3:
+		return Stop1Half, true
+	}
+	return 0, false
+}
+
+// telnetEscape doubles IAC bytes in data.
+func telnetEscape(b []byte) []byte {
+	out := make([]byte, 0, len(b)+4)
+	for _, c := range b {
+		if c == telnetIAC {
+			out = append(out, telnetIAC)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// telnetSubneg builds IAC SB COM-PORT-OPTION cmd payload IAC SE.
+func telnetSubneg(cmd byte, payload ...byte) []byte {
+	out := []byte{telnetIAC, telnetSB, telnetOptComPort, cmd}
+	out = append(out, telnetEscape(payload)...)
+	return append(out, telnetIAC, telnetSE)
+}
+
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOpt // после WILL/WONT/DO/DONT
+	telnetStateSB
+	telnetStateSBIAC
+)
+
+// telnetDecoder splits a telnet stream into data, option negotiation
+// and subnegotiation.
+type telnetDecoder struct {
+	state int
+	verb  byte
+	sb    []byte
+
+	onData   func(b []byte)
+	onOption func(verb, opt byte)
+	onSubneg func(sb []byte)
+	data_tmp []byte
+}
+
+func (d *telnetDecoder) feed(b []byte) {
+	d.data_tmp = d.data_tmp[:0]
+	for _, c := range b {
+		switch d.state {
+		case telnetStateData:
+			if c == telnetIAC {
+				d.state = telnetStateIAC
+			} else {
+				d.data_tmp = append(d.data_tmp, c)
+			}
+		case telnetStateIAC:
+			switch c {
+			case telnetIAC:
+				d.data_tmp = append(d.data_tmp, c)
+				d.state = telnetStateData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				d.verb = c
+				d.state = telnetStateOpt
+			case telnetSB:
+				d.sb = d.sb[:0]
+				d.state = telnetStateSB
+			default:
+				// NOP, GA и прочие команды без параметров
+				d.state = telnetStateData
+			}
+		case telnetStateOpt:
+			d.flush()
+			if d.onOption != nil {
+				d.onOption(d.verb, c)
+			}
+			d.state = telnetStateData
+		case telnetStateSB:
+			if c == telnetIAC {
+				d.state = telnetStateSBIAC
+			} else {
+				d.sb = append(d.sb, c)
+			}
+		case telnetStateSBIAC:
+			switch c {
+			case telnetIAC:
+				d.sb = append(d.sb, c)
+				d.state = telnetStateSB
+			case telnetSE:
+				d.flush()
+				if d.onSubneg != nil {
+					d.onSubneg(d.sb)
+				}
+				d.state = telnetStateData
+			default:
+				// ошибка протокола, отбрасываем подсогласование
+				d.state = telnetStateData
+			}
+		}
+	}
+	d.flush()
+}
+
+func (d *telnetDecoder) flush() {
+	if len(d.data_tmp) > 0 && d.onData != nil {
+		d.onData(d.data_tmp)
+	}
+	d.data_tmp = d.data_tmp[:0]
+}
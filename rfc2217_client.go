@@ -0,0 +1,537 @@
+package serialport
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrRfc2217NotSupported is returned by Connect if the server refuses
+// COM-PORT-OPTION.
+var ErrRfc2217NotSupported = errors.New("rfc2217: com port option refused by server")
+
+// ErrRfc2217NoAck is returned if the server does not confirm a setting.
+var ErrRfc2217NoAck = errors.New("rfc2217: no response from server")
+
+const rfc2217AckTimeout = 2 * time.Second
+
+// SerialRfc2217 is an RFC 2217 (Telnet Com Port Control) client. Besides
+// data transfer it controls the remote port settings and modem lines and
+// tracks line and modem state notifications.
+type SerialRfc2217 struct {
+	dataLogger
+	config Config // Name - адрес сервера host:port
+	con    net.Conn
+
+	mu         sync.Mutex
+	rx         []byte
+	rx_notify  chan struct{}
+	rx_err     error // ошибка соединения, отдается после вычитки rx
+	acks       map[byte]chan []byte
+	negotiated chan bool       // ответ сервера на WILL COM-PORT-OPTION
+	refused    map[uint16]bool // отказы уже отправлены
+	lineState  byte
+	modemState byte
+	suspended  bool
+	resumed    chan struct{}
+	done       chan struct{}
+	recv_done  chan struct{}
+	wg         sync.WaitGroup
+}
+
+func init() {
+	RegisterScheme("rfc2217", openRfc2217URL)
+}
+
+// NewSerialRfc2217 creates a client. c.Name is the server address
+// "host:port", the line settings are applied to the remote port on
+// Connect and c.ReadTimeout is the time to wait for data in Read.
+func NewSerialRfc2217(c *Config) (*SerialRfc2217, error) {
+	if _, _, err := net.SplitHostPort(c.Name); err != nil {
+		return nil, err
+	}
+	s := &SerialRfc2217{config: *c}
+	s.log_port = c.Name
+	if s.config.Size == 0 {
+		s.config.Size = DefaultSize
+	}
+	if s.config.Parity == 0 {
+		s.config.Parity = ParityNone
+	}
+	if s.config.StopBits == 0 {
+		s.config.StopBits = Stop1
+	}
+	return s, nil
+}
+
+// Connect dials the server, negotiates COM-PORT-OPTION and applies the
+// configured baud rate, data size, parity and stop bits.
+func (s *SerialRfc2217) Connect() error {
+	if s.con != nil {
+		s.Close()
+	}
+	con, err := net.DialTimeout("tcp", s.config.Name, rfc2217AckTimeout)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.con = con
+	s.rx = nil
+	s.rx_err = nil
+	s.rx_notify = make(chan struct{}, 1)
+	s.acks = map[byte]chan []byte{}
+	s.negotiated = make(chan bool, 1)
+	s.refused = map[uint16]bool{}
+	s.lineState, s.modemState = 0, 0
+	s.suspended = false
+	s.resumed = make(chan struct{})
+	s.done = make(chan struct{})
+	s.recv_done = make(chan struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.recv(con)
+
+	_, err = con.Write([]byte{
+		telnetIAC, telnetWILL, telnetOptComPort,
+		telnetIAC, telnetWILL, telnetOptBinary,
+		telnetIAC, telnetDO, telnetOptBinary,
+		telnetIAC, telnetWILL, telnetOptSGA,
+		telnetIAC, telnetDO, telnetOptSGA,
+	})
+	if err == nil {
+		select {
+		case ok := <-s.negotiated:
+			if !ok {
+				err = ErrRfc2217NotSupported
+			}
+		case <-s.recv_done:
+			err = s.rx_err
+		case <-time.After(rfc2217AckTimeout):
+			err = ErrRfc2217NotSupported
+		}
+	}
+	if err == nil {
+		err = s.applyConfig()
+	}
+	if err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *SerialRfc2217) applyConfig() error {
+	if s.config.Baud > 0 {
+		if err := s.SetBaud(s.config.Baud); err != nil {
+			return err
+		}
+	}
+	if err := s.SetDataSize(s.config.Size); err != nil {
+		return err
+	}
+	if err := s.SetParity(s.config.Parity); err != nil {
+		return err
+	}
+	if err := s.SetStopBits(s.config.StopBits); err != nil {
+		return err
+	}
+	if _, err := s.command(rfc2217SetLinestateMask, LineBreak|LineFraming|LineParity|LineOverrun); err != nil {
+		return err
+	}
+	_, err := s.command(rfc2217SetModemstateMask, 0xFF)
+	return err
+}
+
+func (s *SerialRfc2217) Close() error {
+	if s.con == nil {
+		return nil
+	}
+	close(s.done)
+	err := s.con.Close()
+	s.wg.Wait()
+	s.con = nil
+	return err
+}
+
+// Reconnect closes the connection, dials again and re-applies the settings.
+func (s *SerialRfc2217) Reconnect() error {
+	s.Close()
+	return s.Connect()
+}
+
+func (s *SerialRfc2217) Is_connect() bool {
+	return s.con != nil
+}
+
+func (s *SerialRfc2217) Write(buf []byte) (int, error) {
+	if s.con == nil {
+		return 0, net.ErrClosed
+	}
+	s.mu.Lock()
+	suspended, resumed := s.suspended, s.resumed
+	s.mu.Unlock()
+	if suspended {
+		// сервер просил приостановить передачу
+		select {
+		case <-resumed:
+		case <-time.After(s.config.ReadTimeout):
+			return 0, ErrTimeout
+		}
+	}
+	s.logData(DirWrite, buf)
+	if _, err := s.con.Write(telnetEscape(buf)); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// Read waits up to ReadTimeout (plus transmission time of estimated_byte)
+// and returns when estimated_byte bytes are available.
+// With estimated_byte <= 0 any received data is returned.
+func (s *SerialRfc2217) Read(buf []byte, estimated_byte int) (int, error) {
+	if s.con == nil {
+		return 0, net.ErrClosed
+	}
+	wait := s.config.ReadTimeout
+	if estimated_byte > 0 {
+		wait += CharDuration(s.config.Baud, s.config.Size, s.config.Parity, s.config.StopBits) * time.Duration(estimated_byte)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	need := estimated_byte
+	if need <= 0 || need > len(buf) {
+		need = 1
+	}
+	for {
+		s.mu.Lock()
+		if len(s.rx) >= need || (s.rx_err != nil && len(s.rx) > 0) {
+			n := copy(buf, s.rx)
+			s.rx = s.rx[n:]
+			s.mu.Unlock()
+			s.logData(DirRead, buf[:n])
+			return n, nil
+		}
+		if s.rx_err != nil {
+			err := s.rx_err
+			s.mu.Unlock()
+			return 0, err
+		}
+		notify := s.rx_notify
+		s.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			s.mu.Lock()
+			n := copy(buf, s.rx)
+			s.rx = s.rx[n:]
+			s.mu.Unlock()
+			if n == 0 {
+				return 0, ErrTimeout
+			}
+			s.logData(DirRead, buf[:n])
+			return n, nil
+		}
+	}
+}
+
+// SetBaud changes the baud rate of the remote port.
+func (s *SerialRfc2217) SetBaud(baud int) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(baud))
+	ack, err := s.command(rfc2217SetBaudrate, b[:]...)
+	if err != nil {
+		return err
+	}
+	if len(ack) == 4 {
+		s.config.Baud = int(binary.BigEndian.Uint32(ack))
+	}
+	return nil
+}
+
+// SetDataSize changes the number of data bits of the remote port.
+func (s *SerialRfc2217) SetDataSize(size byte) error {
+	if size < 5 || size > 8 {
+		return &ConfigError{Field: "Size", Value: size, Err: ErrBadSize}
+	}
+	if _, err := s.command(rfc2217SetDatasize, size); err != nil {
+		return err
+	}
+	s.config.Size = size
+	return nil
+}
+
+// SetParity changes the parity of the remote port.
+func (s *SerialRfc2217) SetParity(p Parity) error {
+	if _, err := s.command(rfc2217SetParity, rfc2217ParityCode(p)); err != nil {
+		return err
+	}
+	s.config.Parity = p
+	return nil
+}
+
+// SetStopBits changes the number of stop bits of the remote port.
+func (s *SerialRfc2217) SetStopBits(stop StopBits) error {
+	if _, err := s.command(rfc2217SetStopsize, rfc2217StopCode(stop)); err != nil {
+		return err
+	}
+	s.config.StopBits = stop
+	return nil
+}
+
+// SetFlowControl changes the flow control of the remote port.
+func (s *SerialRfc2217) SetFlowControl(f FlowControl) error {
+	v := byte(rfc2217ControlFlowNone)
+	switch f {
+	case FlowXonXoff:
+		v = rfc2217ControlFlowXonXoff
+	case FlowHardware:
+		v = rfc2217ControlFlowHardware
+	}
+	_, err := s.command(rfc2217SetControl, v)
+	return err
+}
+
+// SetDTR sets the DTR line of the remote port.
+func (s *SerialRfc2217) SetDTR(on bool) error {
+	return s.control(on, rfc2217ControlDTROn, rfc2217ControlDTROff)
+}
+
+// SetRTS sets the RTS line of the remote port.
+func (s *SerialRfc2217) SetRTS(on bool) error {
+	return s.control(on, rfc2217ControlRTSOn, rfc2217ControlRTSOff)
+}
+
+// SetBreak turns the break condition of the remote port on or off.
+func (s *SerialRfc2217) SetBreak(on bool) error {
+	return s.control(on, rfc2217ControlBreakOn, rfc2217ControlBreakOff)
+}
+
+// Purge discards data in the server receive and/or transmit buffers.
+func (s *SerialRfc2217) Purge(rx, tx bool) error {
+	var v byte
+	if rx {
+		v |= rfc2217PurgeRx
+	}
+	if tx {
+		v |= rfc2217PurgeTx
+	}
+	if v == 0 {
+		return nil
+	}
+	if rx {
+		s.mu.Lock()
+		s.rx = nil
+		s.mu.Unlock()
+	}
+	_, err := s.command(rfc2217PurgeData, v)
+	return err
+}
+
+// LineState returns the last line state notified by the server (Line* bits).
+func (s *SerialRfc2217) LineState() byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lineState
+}
+
+// ModemState returns the last modem state notified by the server (Modem* bits).
+func (s *SerialRfc2217) ModemState() byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.modemState
+}
+
+func (s *SerialRfc2217) control(on bool, vOn, vOff byte) error {
+	v := vOff
+	if on {
+		v = vOn
+	}
+	_, err := s.command(rfc2217SetControl, v)
+	return err
+}
+
+// command sends a COM-PORT-OPTION subnegotiation and waits for the
+// server response, returning its payload.
+func (s *SerialRfc2217) command(cmd byte, payload ...byte) ([]byte, error) {
+	if s.con == nil {
+		return nil, net.ErrClosed
+	}
+	ack := make(chan []byte, 1)
+	s.mu.Lock()
+	s.acks[cmd+rfc2217ServerOffset] = ack
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.acks, cmd+rfc2217ServerOffset)
+		s.mu.Unlock()
+	}()
+
+	if _, err := s.con.Write(telnetSubneg(cmd, payload...)); err != nil {
+		return nil, err
+	}
+	select {
+	case b := <-ack:
+		return b, nil
+	case <-s.recv_done:
+		return nil, net.ErrClosed
+	case <-time.After(rfc2217AckTimeout):
+		return nil, ErrRfc2217NoAck
+	}
+}
+
+func (s *SerialRfc2217) recv(con net.Conn) {
+	defer s.wg.Done()
+	defer close(s.recv_done)
+	d := telnetDecoder{
+		onData: func(b []byte) {
+			s.mu.Lock()
+			s.rx = append(s.rx, b...)
+			s.mu.Unlock()
+			s.notify()
+		},
+		onOption: func(verb, opt byte) {
+			s.option(con, verb, opt)
+		},
+		onSubneg: s.subneg,
+	}
+	buf := make([]byte, 1024)
+	for {
+		n, err := con.Read(buf)
+		if n > 0 {
+			d.feed(buf[:n])
+		}
+		if err != nil {
+			select {
+			case <-s.done:
+				err = net.ErrClosed
+			default:
+			}
+			if err == nil {
+				err = io.EOF
+			}
+			s.mu.Lock()
+			s.rx_err = err
+			s.mu.Unlock()
+			s.notify()
+			return
+		}
+	}
+}
+
+func (s *SerialRfc2217) notify() {
+	s.mu.Lock()
+	ch := s.rx_notify
+	s.mu.Unlock()
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// option answers the server option negotiation: BINARY, SGA and
+// COM-PORT-OPTION are accepted, everything else is refused.
+func (s *SerialRfc2217) option(con net.Conn, verb, opt byte) {
+	supported := opt == telnetOptBinary || opt == telnetOptSGA || opt == telnetOptComPort
+	if opt == telnetOptComPort && (verb == telnetDO || verb == telnetDONT) {
+		select {
+		case s.negotiated <- verb == telnetDO:
+		default:
+		}
+		return
+	}
+	if supported {
+		// запрошено нами при подключении, это подтверждение
+		return
+	}
+	var reply byte
+	switch verb {
+	case telnetDO:
+		reply = telnetWONT
+	case telnetWILL:
+		reply = telnetDONT
+	default:
+		return
+	}
+	key := uint16(reply)<<8 | uint16(opt)
+	s.mu.Lock()
+	answered := s.refused[key]
+	s.refused[key] = true
+	s.mu.Unlock()
+	if answered {
+		return
+	}
+	con.Write([]byte{telnetIAC, reply, opt})
+}
+
+func (s *SerialRfc2217) subneg(sb []byte) {
+	if len(sb) < 2 || sb[0] != telnetOptComPort {
+		return
+	}
+	cmd, payload := sb[1], sb[2:]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch cmd {
+	case rfc2217NotifyLinestate + rfc2217ServerOffset:
+		if len(payload) > 0 {
+			s.lineState = payload[0]
+		}
+		return
+	case rfc2217NotifyModemstate + rfc2217ServerOffset:
+		if len(payload) > 0 {
+			s.modemState = payload[0]
+		}
+		return
+	case rfc2217FlowSuspend + rfc2217ServerOffset:
+		if !s.suspended {
+			s.suspended = true
+			s.resumed = make(chan struct{})
+		}
+		return
+	case rfc2217FlowResume + rfc2217ServerOffset:
+		if s.suspended {
+			s.suspended = false
+			close(s.resumed)
+		}
+		return
+	}
+	if ack, ok := s.acks[cmd]; ok {
+		select {
+		case ack <- append([]byte(nil), payload...):
+		default:
+		}
+	}
+}
+
+// rfc2217://host:port?baud=9600&size=8&parity=N&stop=1&timeout=500ms
+func openRfc2217URL(u *url.URL) (InterfaceSerial, error) {
+	q := u.Query()
+	c := Config{Name: u.Host}
+	var err error
+	if c.Baud, err = urlInt(q, "baud", 0); err != nil {
+		return nil, err
+	}
+	size, err := urlInt(q, "size", DefaultSize)
+	if err != nil {
+		return nil, err
+	}
+	if size < 5 || size > 8 {
+		return nil, &ConfigError{Field: "Size", Value: size, Err: ErrBadSize}
+	}
+	c.Size = byte(size)
+	if c.Parity, err = ParseParity(q.Get("parity")); err != nil {
+		return nil, err
+	}
+	if c.StopBits, err = ParseStopBits(q.Get("stop")); err != nil {
+		return nil, err
+	}
+	if c.ReadTimeout, err = urlDuration(q, "timeout", defaultURLTimeout); err != nil {
+		return nil, err
+	}
+	return NewSerialRfc2217(&c)
+}
@@ -0,0 +1,459 @@
+package serialport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const rfc2217PollInterval = 50 * time.Millisecond
+
+// Rfc2217Server publishes a local Port as an RFC 2217 endpoint. Remote
+// settings requests are applied to the live port, line and modem state
+// changes are notified to the client. One client is served at a time.
+type Rfc2217Server struct {
+	port      *Port
+	signature string
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	session   *rfc2217Session
+	closed    bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+type rfc2217Session struct {
+	srv  *Rfc2217Server
+	con  net.Conn
+	done chan struct{}
+	once sync.Once
+
+	wmu sync.Mutex // запись в con
+
+	mu        sync.Mutex
+	lineMask  byte
+	modemMask byte
+	suspended bool
+	breakOn   bool
+	sentOpts  map[uint16]bool
+}
+
+// NewRfc2217Server creates a server for port.
+func NewRfc2217Server(port *Port) *Rfc2217Server {
+	return &Rfc2217Server{
+		port:      port,
+		signature: "serialport",
+		listeners: map[net.Listener]struct{}{},
+		done:      make(chan struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Rfc2217Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts clients on ln until Close is called. It always returns
+// a non-nil error, ErrServerClosed after Close.
+func (s *Rfc2217Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+		ln.Close()
+	}()
+	for {
+		con, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.session != nil || s.closed {
+			// порт занят
+			s.mu.Unlock()
+			con.Close()
+			continue
+		}
+		ss := &rfc2217Session{srv: s, con: con, done: make(chan struct{}), sentOpts: map[uint16]bool{}}
+		s.session = ss
+		s.wg.Add(2)
+		s.mu.Unlock()
+		go ss.run()
+		go ss.portToClient()
+	}
+}
+
+// Close stops the listeners, disconnects the client and waits for the
+// session to end. The port itself is not closed.
+func (s *Rfc2217Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	ss := s.session
+	s.mu.Unlock()
+	if ss != nil {
+		ss.close()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (ss *rfc2217Session) close() {
+	ss.once.Do(func() {
+		close(ss.done)
+		ss.con.Close()
+		ss.srv.mu.Lock()
+		if ss.srv.session == ss {
+			ss.srv.session = nil
+		}
+		ss.srv.mu.Unlock()
+	})
+}
+
+func (ss *rfc2217Session) write(b []byte) error {
+	ss.wmu.Lock()
+	defer ss.wmu.Unlock()
+	_, err := ss.con.Write(b)
+	return err
+}
+
+func (ss *rfc2217Session) run() {
+	defer ss.srv.wg.Done()
+	defer ss.close()
+	port := ss.srv.port
+	d := telnetDecoder{
+		onData: func(b []byte) {
+			port.Write(b)
+		},
+		onOption: ss.option,
+		onSubneg: ss.subneg,
+	}
+	buf := make([]byte, 1024)
+	for {
+		n, err := ss.con.Read(buf)
+		if n > 0 {
+			d.feed(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// option accepts BINARY and SGA in both directions and COM-PORT-OPTION
+// from the client, everything else is refused.
+func (ss *rfc2217Session) option(verb, opt byte) {
+	var reply byte
+	switch verb {
+	case telnetWILL:
+		reply = telnetDONT
+		if opt == telnetOptBinary || opt == telnetOptSGA || opt == telnetOptComPort {
+			reply = telnetDO
+		}
+	case telnetDO:
+		reply = telnetWONT
+		if opt == telnetOptBinary || opt == telnetOptSGA {
+			reply = telnetWILL
+		}
+	default:
+		return
+	}
+	key := uint16(reply)<<8 | uint16(opt)
+	ss.mu.Lock()
+	sent := ss.sentOpts[key]
+	ss.sentOpts[key] = true
+	ss.mu.Unlock()
+	if !sent {
+		ss.write([]byte{telnetIAC, reply, opt})
+	}
+}
+
+func (ss *rfc2217Session) reply(cmd byte, payload ...byte) {
+	ss.write(telnetSubneg(cmd+rfc2217ServerOffset, payload...))
+}
+
+func (ss *rfc2217Session) subneg(sb []byte) {
+	if len(sb) < 2 || sb[0] != telnetOptComPort {
+		return
+	}
+	port := ss.srv.port
+	cmd, v := sb[1], sb[2:]
+	var arg byte
+	if len(v) > 0 {
+		arg = v[0]
+	}
+	switch cmd {
+	case rfc2217Signature:
+		if len(v) == 0 {
+			ss.reply(cmd, []byte(ss.srv.signature)...)
+		}
+	case rfc2217SetBaudrate:
+		if len(v) != 4 {
+			return
+		}
+		if baud := binary.BigEndian.Uint32(v); baud != 0 {
+			port.SetBaud(int(baud))
+		}
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(port.baud))
+		ss.reply(cmd, b[:]...)
+	case rfc2217SetDatasize:
+		if arg != 0 {
+			port.SetSize(arg)
+		}
+		ss.reply(cmd, port.size)
+	case rfc2217SetParity:
+		if p, ok := rfc2217Parity(arg); ok {
+			port.SetParity(p)
+		}
+		ss.reply(cmd, rfc2217ParityCode(port.parity))
+	case rfc2217SetStopsize:
+		if stop, ok := rfc2217StopBits(arg); ok {
+			port.SetStopBits(stop)
+		}
+		ss.reply(cmd, rfc2217StopCode(port.stopBits))
+	case rfc2217SetControl:
+		ss.reply(cmd, ss.control(arg))
+	case rfc2217FlowSuspend, rfc2217FlowResume:
+		ss.mu.Lock()
+		ss.suspended = cmd == rfc2217FlowSuspend
+		ss.mu.Unlock()
+	case rfc2217SetLinestateMask:
+		ss.mu.Lock()
+		ss.lineMask = arg
+		ss.mu.Unlock()
+		ss.reply(cmd, arg)
+	case rfc2217SetModemstateMask:
+		ss.mu.Lock()
+		ss.modemMask = arg
+		ss.mu.Unlock()
+		ss.reply(cmd, arg)
+		if lines, err := port.ModemLines(); err == nil && arg != 0 {
+			ss.reply(rfc2217NotifyModemstate, modemStateBits(lines)&arg)
+		}
+	case rfc2217PurgeData:
+		switch arg {
+		case rfc2217PurgeRx:
+			port.FlushInput()
+		case rfc2217PurgeTx:
+			port.FlushOutput()
+		case rfc2217PurgeBoth:
+			port.Flush()
+		}
+		ss.reply(cmd, arg)
+	}
+}
+
+// control applies a SET-CONTROL request and returns the response value.
+func (ss *rfc2217Session) control(v byte) byte {
+	port := ss.srv.port
+	lineReply := func(line int, on, off byte) byte {
+		if lines, err := port.ModemLines(); err == nil && lines&line == 0 {
+			return off
+		}
+		return on
+	}
+	inbound := false
+	switch v {
+	case rfc2217ControlFlowRequest:
+	case rfc2217ControlFlowNone:
+		port.SetFlowControl(FlowNone)
+	case rfc2217ControlFlowXonXoff:
+		port.SetFlowControl(FlowXonXoff)
+	case rfc2217ControlFlowHardware:
+		port.SetFlowControl(FlowHardware)
+	// входящий поток управляется тем же termios, что и исходящий
+	case rfc2217ControlInFlowRequest:
+		inbound = true
+	case rfc2217ControlInFlowNone:
+		inbound = true
+		port.SetFlowControl(FlowNone)
+	case rfc2217ControlInFlowXonXoff:
+		inbound = true
+		port.SetFlowControl(FlowXonXoff)
+	case rfc2217ControlInFlowHardware:
+		inbound = true
+		port.SetFlowControl(FlowHardware)
+	case rfc2217ControlBreakRequest:
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+		if ss.breakOn {
+			return rfc2217ControlBreakOn
+		}
+		return rfc2217ControlBreakOff
+	case rfc2217ControlBreakOn, rfc2217ControlBreakOff:
+		if port.SetBreak(v == rfc2217ControlBreakOn) == nil {
+			ss.mu.Lock()
+			ss.breakOn = v == rfc2217ControlBreakOn
+			ss.mu.Unlock()
+		}
+		return v
+	case rfc2217ControlDTRRequest:
+		return lineReply(unix.TIOCM_DTR, rfc2217ControlDTROn, rfc2217ControlDTROff)
+	case rfc2217ControlDTROn, rfc2217ControlDTROff:
+		port.SetDTR(v == rfc2217ControlDTROn)
+		return v
+	case rfc2217ControlRTSRequest:
+		return lineReply(unix.TIOCM_RTS, rfc2217ControlRTSOn, rfc2217ControlRTSOff)
+	case rfc2217ControlRTSOn, rfc2217ControlRTSOff:
+		port.SetRTS(v == rfc2217ControlRTSOn)
+		return v
+	default:
+		return v
+	}
+	// ответ - фактическое состояние порта
+	switch {
+	case port.flow == FlowXonXoff && inbound:
+		return rfc2217ControlInFlowXonXoff
+	case port.flow == FlowXonXoff:
+		return rfc2217ControlFlowXonXoff
+	case port.flow == FlowHardware && inbound:
+		return rfc2217ControlInFlowHardware
+	case port.flow == FlowHardware:
+		return rfc2217ControlFlowHardware
+	case inbound:
+		return rfc2217ControlInFlowNone
+	}
+	return rfc2217ControlFlowNone
+}
+
+func modemStateBits(lines int) byte {
+	var b byte
+	if lines&unix.TIOCM_CD != 0 {
+		b |= ModemCD
+	}
+	if lines&unix.TIOCM_RI != 0 {
+		b |= ModemRI
+	}
+	if lines&unix.TIOCM_DSR != 0 {
+		b |= ModemDSR
+	}
+	if lines&unix.TIOCM_CTS != 0 {
+		b |= ModemCTS
+	}
+	return b
+}
+
+// portToClient forwards received data and polls line and modem state.
+func (ss *rfc2217Session) portToClient() {
+	defer ss.srv.wg.Done()
+	defer ss.close()
+	port := ss.srv.port
+	pollModem, pollLine := true, true
+	var prevModem byte
+	if lines, err := port.ModemLines(); err == nil {
+		prevModem = modemStateBits(lines)
+	} else {
+		pollModem = false
+	}
+	prevCount, err := port.lineCounters()
+	if err != nil {
+		pollLine = false
+	}
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-ss.done:
+			return
+		default:
+		}
+		ss.mu.Lock()
+		suspended, lineMask, modemMask := ss.suspended, ss.lineMask, ss.modemMask
+		ss.mu.Unlock()
+
+		if suspended {
+			time.Sleep(rfc2217PollInterval)
+		} else if port.Wait(rfc2217PollInterval.Milliseconds()) != 0 {
+			n, err := port.Read(buf)
+			if n > 0 {
+				if ss.write(telnetEscape(buf[:n])) != nil {
+					return
+				}
+			}
+			if err != nil && !errors.Is(err, unix.EAGAIN) {
+				return
+			}
+		}
+
+		if pollModem {
+			if lines, err := port.ModemLines(); err == nil {
+				cur := modemStateBits(lines)
+				delta := cur ^ prevModem
+				if delta != 0 {
+					state := cur
+					if delta&ModemCD != 0 {
+						state |= ModemDeltaCD
+					}
+					if prevModem&ModemRI != 0 && cur&ModemRI == 0 {
+						state |= ModemTrailRI
+					}
+					if delta&ModemDSR != 0 {
+						state |= ModemDeltaDSR
+					}
+					if delta&ModemCTS != 0 {
+						state |= ModemDeltaCTS
+					}
+					if state&modemMask&^modemStateMask != 0 {
+						ss.reply(rfc2217NotifyModemstate, state&modemMask)
+					}
+					prevModem = cur
+				}
+			}
+		}
+		if pollLine {
+			if c, err := port.lineCounters(); err == nil {
+				var state byte
+				if c.frame != prevCount.frame {
+					state |= LineFraming
+				}
+				if c.parity != prevCount.parity {
+					state |= LineParity
+				}
+				if c.overrun != prevCount.overrun || c.buf_overrun != prevCount.buf_overrun {
+					state |= LineOverrun
+				}
+				if c.brk != prevCount.brk {
+					state |= LineBreak
+				}
+				if state&lineMask != 0 {
+					ss.reply(rfc2217NotifyLinestate, state&lineMask)
+				}
+				prevCount = c
+			}
+		}
+	}
+}
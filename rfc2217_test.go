@@ -0,0 +1,248 @@
+package serialport
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTelnetDecoder(t *testing.T) {
+	var data []byte
+	var opts [][2]byte
+	var subs [][]byte
+	d := telnetDecoder{
+		onData:   func(b []byte) { data = append(data, b...) },
+		onOption: func(verb, opt byte) { opts = append(opts, [2]byte{verb, opt}) },
+		onSubneg: func(sb []byte) { subs = append(subs, append([]byte(nil), sb...)) },
+	}
+	stream := []byte{0x01, telnetIAC, telnetIAC, 0x02, telnetIAC, telnetDO, telnetOptComPort}
+	stream = append(stream, telnetSubneg(rfc2217SetBaudrate+rfc2217ServerOffset, 0x00, 0x00, 0x25, telnetIAC)...)
+	stream = append(stream, 0x03)
+	// подаем по одному байту, состояние должно сохраняться между вызовами
+	for _, c := range stream {
+		d.feed([]byte{c})
+	}
+	if !bytes.Equal(data, []byte{0x01, 0xFF, 0x02, 0x03}) {
+		t.Errorf("data %X", data)
+	}
+	if len(opts) != 1 || opts[0] != [2]byte{telnetDO, telnetOptComPort} {
+		t.Errorf("options %v", opts)
+	}
+	if len(subs) != 1 || !bytes.Equal(subs[0], []byte{telnetOptComPort, 101, 0x00, 0x00, 0x25, 0xFF}) {
+		t.Errorf("subneg %X", subs)
+	}
+}
+
+// минимальный RFC 2217 сервер: подтверждает команды и отвечает эхом
+func fakeRfc2217Server(t *testing.T, got chan<- []byte) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		con, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer con.Close()
+		d := telnetDecoder{
+			onData: func(b []byte) {
+				con.Write(telnetEscape(b))
+			},
+			onOption: func(verb, opt byte) {
+				if verb == telnetWILL && opt == telnetOptComPort {
+					con.Write([]byte{telnetIAC, telnetDO, telnetOptComPort})
+				}
+			},
+			onSubneg: func(sb []byte) {
+				got <- append([]byte(nil), sb...)
+				con.Write(telnetSubneg(sb[1]+rfc2217ServerOffset, sb[2:]...))
+				if sb[1] == rfc2217SetModemstateMask {
+					con.Write(telnetSubneg(rfc2217NotifyModemstate+rfc2217ServerOffset, ModemCTS|ModemDSR))
+				}
+			},
+		}
+		buf := make([]byte, 256)
+		for {
+			n, err := con.Read(buf)
+			if err != nil {
+				return
+			}
+			d.feed(buf[:n])
+		}
+	}()
+	return ln
+}
+
+func TestSerialRfc2217(t *testing.T) {
+	got := make(chan []byte, 32)
+	ln := fakeRfc2217Server(t, got)
+	defer ln.Close()
+
+	s, err := NewFromURL("rfc2217://" + ln.Addr().String() + "?baud=19200&parity=E&timeout=300ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := s.(*SerialRfc2217)
+
+	expected := [][]byte{
+		{telnetOptComPort, rfc2217SetBaudrate, 0x00, 0x00, 0x4B, 0x00},
+		{telnetOptComPort, rfc2217SetDatasize, 8},
+		{telnetOptComPort, rfc2217SetParity, 3},
+		{telnetOptComPort, rfc2217SetStopsize, 1},
+	}
+	for _, e := range expected {
+		if b := <-got; !bytes.Equal(b, e) {
+			t.Errorf("subneg %X, expected %X", b, e)
+		}
+	}
+
+	if err := c.SetRTS(true); err != nil {
+		t.Error(err)
+	}
+	for b := range got {
+		if b[1] == rfc2217SetControl {
+			if b[2] != rfc2217ControlRTSOn {
+				t.Errorf("SET-CONTROL %X", b)
+			}
+			break
+		}
+	}
+	if c.ModemState() != ModemCTS|ModemDSR {
+		t.Errorf("modem state %X", c.ModemState())
+	}
+
+	msg := []byte{0x01, 0xFF, 0xFF, 0x02}
+	if _, err := c.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := c.Read(buf, len(msg))
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	if _, err := c.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+}
+
+func TestSerialRfc2217Refused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		con, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer con.Close()
+		con.Write([]byte{telnetIAC, telnetDONT, telnetOptComPort})
+		time.Sleep(100 * time.Millisecond)
+	}()
+	s, _ := NewSerialRfc2217(&Config{Name: ln.Addr().String()})
+	if err := s.Connect(); err != ErrRfc2217NotSupported {
+		t.Errorf("ожидается ErrRfc2217NotSupported, получено %v", err)
+	}
+	if s.Is_connect() {
+		t.Error("Is_connect после отказа")
+	}
+}
+
+func TestRfc2217Server(t *testing.T) {
+	master, err := NewSerialPortPty(300 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Connect(); err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	srv := NewRfc2217Server(slave)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	c, _ := NewSerialRfc2217(&Config{Name: ln.Addr().String(), Baud: 19200, Size: 7, Parity: ParityEven, StopBits: Stop2, ReadTimeout: 300 * time.Millisecond})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if slave.baud != 19200 || slave.size != 7 || slave.parity != ParityEven || slave.stopBits != Stop2 {
+		t.Errorf("настройки порта %d %d %c %d", slave.baud, slave.size, slave.parity, slave.stopBits)
+	}
+	if c.config.Baud != 19200 {
+		t.Errorf("подтвержденная скорость %d", c.config.Baud)
+	}
+
+	msg := []byte{0x10, 0xFF, 0x20}
+	if _, err := c.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := master.Read(buf, 0)
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Errorf("порт получил %X %v", buf[:n], err)
+	}
+
+	master.Write([]byte{0xFF, 0x30})
+	n, err = c.Read(buf, 2)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0xFF, 0x30}) {
+		t.Errorf("клиент получил %X %v", buf[:n], err)
+	}
+
+	if err := c.Purge(true, true); err != nil {
+		t.Error(err)
+	}
+
+	// второй клиент отклоняется, пока занят первый
+	c2, _ := NewSerialRfc2217(&Config{Name: ln.Addr().String()})
+	if err := c2.Connect(); err == nil {
+		c2.Close()
+		t.Error("второй клиент подключен")
+	}
+}
+
+func TestRfc2217ServerInboundFlow(t *testing.T) {
+	p, _, err := openPty()
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer p.Close()
+	ss := &rfc2217Session{srv: NewRfc2217Server(p)}
+	tt := []struct {
+		set, want byte
+	}{
+		{rfc2217ControlInFlowRequest, rfc2217ControlInFlowNone},
+		{rfc2217ControlInFlowHardware, rfc2217ControlInFlowHardware},
+		{rfc2217ControlInFlowRequest, rfc2217ControlInFlowHardware},
+		{rfc2217ControlFlowRequest, rfc2217ControlFlowHardware},
+		{rfc2217ControlInFlowXonXoff, rfc2217ControlInFlowXonXoff},
+		{rfc2217ControlInFlowNone, rfc2217ControlInFlowNone},
+	}
+	for _, tc := range tt {
+		if got := ss.control(tc.set); got != tc.want {
+			t.Errorf("SET-CONTROL %d: ответ %d, ожидался %d", tc.set, got, tc.want)
+		}
+	}
+	if p.flow != FlowNone {
+		t.Errorf("управление потоком %d", p.flow)
+	}
+}
@@ -10,6 +10,9 @@ const DefaultSize = 8 // Default value for Config.Size
 type StopBits byte
 type Parity byte
 
+// FlowControl selects the flow control of a port.
+type FlowControl byte
+
 const (
 	Stop1     StopBits = 1
 	Stop1Half StopBits = 15
@@ -24,6 +27,12 @@ const (
 	ParitySpace Parity = 'S' // parity bit is always 0
 )
 
+const (
+	FlowNone     FlowControl = iota
+	FlowXonXoff              // software, XON/XOFF
+	FlowHardware             // RTS/CTS
+)
+
 // Config contains the information needed to open a serial port.
 //
 // Currently few options are implemented, but more may be added in the
@@ -54,6 +63,15 @@ type Config struct {
 	// Number of stop bits to use. Default is 1 (1 stop bit).
 	StopBits StopBits
 
+	// TxCharGap is an extra idle time inserted after every transmitted
+	// character. If 0, the buffer is written at once.
+	TxCharGap time.Duration
+
+	// TxFrameGap is the minimum line idle time before a Write starts,
+	// counted from the end of the previous transmission or reception
+	// (e.g. FrameGapT35 for Modbus RTU).
+	TxFrameGap time.Duration
+
 	// RTSFlowControl bool
 	// DTRFlowControl bool
 	// XONFlowControl bool
@@ -70,7 +88,8 @@ var ErrBadStopBits error = errors.New("unsupported stop bit setting")
 // ErrBadParity is returned if the parity is not supported.
 var ErrBadParity error = errors.New("unsupported parity setting")
 
-var ErrTimeout error = errors.New("timeout")
+// ErrTimeout is returned by Read if no data arrived in time.
+var ErrTimeout error = TimeoutError{}
 
 // OpenPort opens a serial port with the specified configuration
 func OpenPort(c *Config) (*Port, error) {
@@ -84,7 +103,46 @@ func OpenPort(c *Config) (*Port, error) {
 	if stop == 0 {
 		stop = Stop1
 	}
-	return openPort(c.Name, c.Baud, size, par, stop, c.ReadTimeout)
+	p, err := openPort(c.Name, c.Baud, size, par, stop, c.ReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+	p.SetTxPacing(c.TxCharGap, c.TxFrameGap)
+	return p, nil
+}
+
+// CharDuration returns the time needed to transmit one character:
+// start bit, data bits, parity bit (if any) and stop bits.
+func CharDuration(baud int, size byte, parity Parity, stop StopBits) time.Duration {
+	if baud <= 0 {
+		return 0
+	}
+	if size == 0 {
+		size = DefaultSize
+	}
+	// count in half bits because of 1.5 stop bits
+	halfBits := 2 * (1 + int64(size))
+	if parity != 0 && parity != ParityNone {
+		halfBits += 2
+	}
+	switch stop {
+	case Stop1Half:
+		halfBits += 3
+	case Stop2:
+		halfBits += 4
+	default:
+		halfBits += 2
+	}
+	return time.Duration(halfBits * int64(time.Second) / (2 * int64(baud)))
+}
+
+// FrameGapT35 returns the Modbus RTU inter-frame silence t3.5.
+// Above 19200 baud the spec fixes it to 1750us.
+func FrameGapT35(baud int, size byte, parity Parity, stop StopBits) time.Duration {
+	if baud > 19200 {
+		return 1750 * time.Microsecond
+	}
+	return CharDuration(baud, size, parity, stop) * 7 / 2
 }
 
 // Converts the timeout values for Linux / POSIX systems
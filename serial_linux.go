@@ -1,52 +1,55 @@
 package serialport
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
-func openPort(name string, baud int, databits byte, parity Parity, stopbits StopBits, readTimeout time.Duration) (p *Port, err error) {
-	var bauds = map[int]uint32{
-		50:      unix.B50,
-		75:      unix.B75,
-		110:     unix.B110,
-		134:     unix.B134,
-		150:     unix.B150,
-		200:     unix.B200,
-		300:     unix.B300,
-		600:     unix.B600,
-		1200:    unix.B1200,
-		1800:    unix.B1800,
-		2400:    unix.B2400,
-		4800:    unix.B4800,
-		9600:    unix.B9600,
-		19200:   unix.B19200,
-		38400:   unix.B38400,
-		57600:   unix.B57600,
-		115200:  unix.B115200,
-		230400:  unix.B230400,
-		460800:  unix.B460800,
-		500000:  unix.B500000,
-		576000:  unix.B576000,
-		921600:  unix.B921600,
-		1000000: unix.B1000000,
-		1152000: unix.B1152000,
-		1500000: unix.B1500000,
-		2000000: unix.B2000000,
-		2500000: unix.B2500000,
-		3000000: unix.B3000000,
-		3500000: unix.B3500000,
-		4000000: unix.B4000000,
-	}
+var bauds = map[int]uint32{
+	50:      unix.B50,
+	75:      unix.B75,
+	110:     unix.B110,
+	134:     unix.B134,
+	150:     unix.B150,
+	200:     unix.B200,
+	300:     unix.B300,
+	600:     unix.B600,
+	1200:    unix.B1200,
+	1800:    unix.B1800,
+	2400:    unix.B2400,
+	4800:    unix.B4800,
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	500000:  unix.B500000,
+	576000:  unix.B576000,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	1152000: unix.B1152000,
+	1500000: unix.B1500000,
+	2000000: unix.B2000000,
+	2500000: unix.B2500000,
+	3000000: unix.B3000000,
+	3500000: unix.B3500000,
+	4000000: unix.B4000000,
+}
 
+func openPort(name string, baud int, databits byte, parity Parity, stopbits StopBits, readTimeout time.Duration) (p *Port, err error) {
 	rate, ok := bauds[baud]
 
 	if !ok {
-		return nil, fmt.Errorf("Unrecognized baud rate")
+		return nil, &ConfigError{Field: "Baud", Value: baud, Err: ErrBadBaud}
 	}
 
 	f, err := os.OpenFile(name, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_NDELAY, 0666)
@@ -72,7 +75,7 @@ func openPort(name string, baud int, databits byte, parity Parity, stopbits Stop
 	case 8:
 		cflagToUse |= unix.CS8
 	default:
-		return nil, ErrBadSize
+		return nil, &ConfigError{Field: "Size", Value: databits, Err: ErrBadSize}
 	}
 	// Stop bits settings
 	switch stopbits {
@@ -82,7 +85,7 @@ func openPort(name string, baud int, databits byte, parity Parity, stopbits Stop
 		cflagToUse |= unix.CSTOPB
 	default:
 		// Don't know how to set 1.5
-		return nil, ErrBadStopBits
+		return nil, &ConfigError{Field: "StopBits", Value: stopbits, Err: ErrBadStopBits}
 	}
 	// Parity settings
 	switch parity {
@@ -94,7 +97,7 @@ func openPort(name string, baud int, databits byte, parity Parity, stopbits Stop
 	case ParityEven:
 		cflagToUse |= unix.PARENB
 	default:
-		return nil, ErrBadParity
+		return nil, &ConfigError{Field: "Parity", Value: parity, Err: ErrBadParity}
 	}
 
 	fd := f.Fd()
@@ -124,21 +127,165 @@ func openPort(name string, baud int, databits byte, parity Parity, stopbits Stop
 		return
 	}
 
-	return &Port{f: f}, nil
+	p = &Port{f: f, baud: baud, size: databits, parity: parity, stopBits: stopbits}
+	p.charDuration = CharDuration(baud, databits, parity, stopbits)
+	return p, nil
+}
+
+// openPty creates a pseudo-terminal pair in raw mode and returns its
+// master side and the path of the slave device.
+func openPty() (p *Port, name string, err error) {
+	f, err := os.OpenFile("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+	fd := int(f.Fd())
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		return
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		return
+	}
+	// termios мастера и слейва общие, переводим в raw
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB
+	t.Cflag |= unix.CS8
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err = unix.IoctlSetTermios(fd, unix.TCSETS, t); err != nil {
+		return
+	}
+	if err = unix.SetNonblock(fd, true); err != nil {
+		return
+	}
+	return &Port{f: f}, fmt.Sprintf("/dev/pts/%d", n), nil
 }
 
 type Port struct {
 	// We intentionly do not use an "embedded" struct so that we
 	// don't export File
 	f *os.File
+
+	baud         int
+	size         byte
+	parity       Parity
+	stopBits     StopBits
+	flow         FlowControl
+	charDuration time.Duration // время передачи одного символа
+	tmu          sync.Mutex    // txEnd, rxLast, паузы: Read, Write и SetTxPacing могут идти параллельно
+	txCharGap    time.Duration
+	txFrameGap   time.Duration
+	txEnd        time.Time // оценка окончания последней передачи
+	rxLast       time.Time // время последнего приема
+	noLsr        bool      // драйвер не поддерживает TIOCSERGETLSR
+}
+
+// CharDuration returns the time on the wire of one character for the
+// port's baud rate and framing.
+func (p *Port) CharDuration() time.Duration {
+	return p.charDuration
+}
+
+// SetTxPacing sets the inter-character gap and the minimum idle time
+// before a frame. Zero values disable the corresponding delay.
+func (p *Port) SetTxPacing(charGap, frameGap time.Duration) {
+	p.tmu.Lock()
+	p.txCharGap = charGap
+	p.txFrameGap = frameGap
+	p.tmu.Unlock()
 }
 
 func (p *Port) Read(b []byte) (n int, err error) {
-	return p.f.Read(b)
+	n, err = p.f.Read(b)
+	if n > 0 {
+		p.tmu.Lock()
+		p.rxLast = time.Now()
+		p.tmu.Unlock()
+	}
+	return n, p.ioErr(err)
+}
+
+// ioErr wraps errors of a vanished device (USB unplug, hangup) into
+// DisconnectError.
+func (p *Port) ioErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, e := range []error{io.EOF, unix.EIO, unix.ENXIO, unix.ENODEV} {
+		if errors.Is(err, e) {
+			return &DisconnectError{Port: p.f.Name(), Err: err}
+		}
+	}
+	return err
 }
 
 func (p *Port) Write(b []byte) (n int, err error) {
-	return p.f.Write(b)
+	p.tmu.Lock()
+	charGap, frameGap := p.txCharGap, p.txFrameGap
+	p.tmu.Unlock()
+	p.waitFrameGap(frameGap)
+	if charGap <= 0 {
+		n, err = p.f.Write(b)
+		p.setTxEnd(time.Now().Add(p.charDuration * time.Duration(n)))
+		return n, p.ioErr(err)
+	}
+	for n < len(b) {
+		var w int
+		w, err = p.f.Write(b[n : n+1])
+		n += w
+		if err != nil {
+			break
+		}
+		time.Sleep(p.charDuration + charGap)
+	}
+	p.setTxEnd(time.Now())
+	return n, p.ioErr(err)
+}
+
+// WaitTxDone sleeps until the last written data is expected to have
+// left the transmitter.
+func (p *Port) WaitTxDone() {
+	sleepUntil(p.txEndAt())
+}
+
+func (p *Port) setTxEnd(t time.Time) {
+	p.tmu.Lock()
+	p.txEnd = t
+	p.tmu.Unlock()
+}
+
+func (p *Port) txEndAt() time.Time {
+	p.tmu.Lock()
+	defer p.tmu.Unlock()
+	return p.txEnd
+}
+
+func (p *Port) waitFrameGap(frameGap time.Duration) {
+	if frameGap <= 0 {
+		return
+	}
+	p.tmu.Lock()
+	idle := p.txEnd
+	if p.rxLast.After(idle) {
+		idle = p.rxLast
+	}
+	p.tmu.Unlock()
+	if idle.IsZero() {
+		return
+	}
+	sleepUntil(idle.Add(frameGap))
 }
 
 // Discards data written to the port but not transmitted,
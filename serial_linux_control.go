@@ -0,0 +1,259 @@
+package serialport
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Live changes of the port settings and modem lines.
+
+func (p *Port) updateTermios(update func(t *unix.Termios) error) error {
+	fd := int(p.f.Fd())
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	if err := update(t); err != nil {
+		return err
+	}
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
+
+// SetBaud changes the baud rate of the open port.
+func (p *Port) SetBaud(baud int) error {
+	rate, ok := bauds[baud]
+	if !ok {
+		return &ConfigError{Field: "Baud", Value: baud, Err: ErrBadBaud}
+	}
+	err := p.updateTermios(func(t *unix.Termios) error {
+		t.Cflag &^= unix.CBAUD
+		t.Cflag |= rate
+		t.Ispeed = rate
+		t.Ospeed = rate
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.baud = baud
+	p.charDuration = CharDuration(p.baud, p.size, p.parity, p.stopBits)
+	return nil
+}
+
+// SetSize changes the number of data bits of the open port.
+func (p *Port) SetSize(size byte) error {
+	var cs uint32
+	switch size {
+	case 5:
+		cs = unix.CS5
+	case 6:
+		cs = unix.CS6
+	case 7:
+		cs = unix.CS7
+	case 8:
+		cs = unix.CS8
+	default:
+		return &ConfigError{Field: "Size", Value: size, Err: ErrBadSize}
+	}
+	err := p.updateTermios(func(t *unix.Termios) error {
+		t.Cflag &^= unix.CSIZE
+		t.Cflag |= cs
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.size = size
+	p.charDuration = CharDuration(p.baud, p.size, p.parity, p.stopBits)
+	return nil
+}
+
+// SetParity changes the parity of the open port.
+func (p *Port) SetParity(parity Parity) error {
+	var flags uint32
+	switch parity {
+	case ParityNone:
+	case ParityOdd:
+		flags = unix.PARENB | unix.PARODD
+	case ParityEven:
+		flags = unix.PARENB
+	case ParityMark:
+		flags = unix.PARENB | unix.CMSPAR | unix.PARODD
+	case ParitySpace:
+		flags = unix.PARENB | unix.CMSPAR
+	default:
+		return &ConfigError{Field: "Parity", Value: parity, Err: ErrBadParity}
+	}
+	err := p.updateTermios(func(t *unix.Termios) error {
+		t.Cflag &^= unix.PARENB | unix.PARODD | unix.CMSPAR
+		t.Cflag |= flags
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.parity = parity
+	p.charDuration = CharDuration(p.baud, p.size, p.parity, p.stopBits)
+	return nil
+}
+
+// SetStopBits changes the number of stop bits of the open port.
+func (p *Port) SetStopBits(stop StopBits) error {
+	var flags uint32
+	switch stop {
+	case Stop1:
+	case Stop2:
+		flags = unix.CSTOPB
+	default:
+		return &ConfigError{Field: "StopBits", Value: stop, Err: ErrBadStopBits}
+	}
+	err := p.updateTermios(func(t *unix.Termios) error {
+		t.Cflag &^= unix.CSTOPB
+		t.Cflag |= flags
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.stopBits = stop
+	p.charDuration = CharDuration(p.baud, p.size, p.parity, p.stopBits)
+	return nil
+}
+
+// SetFlowControl changes the flow control of the open port.
+func (p *Port) SetFlowControl(flow FlowControl) error {
+	err := p.updateTermios(func(t *unix.Termios) error {
+		t.Cflag &^= unix.CRTSCTS
+		t.Iflag &^= unix.IXON | unix.IXOFF
+		switch flow {
+		case FlowNone:
+		case FlowXonXoff:
+			t.Iflag |= unix.IXON | unix.IXOFF
+		case FlowHardware:
+			t.Cflag |= unix.CRTSCTS
+		default:
+			return &ConfigError{Field: "FlowControl", Value: flow, Err: ErrBadFlowControl}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.flow = flow
+	return nil
+}
+
+func (p *Port) setModemLine(line int, on bool) error {
+	req := uint(unix.TIOCMBIC)
+	if on {
+		req = unix.TIOCMBIS
+	}
+	return unix.IoctlSetPointerInt(int(p.f.Fd()), req, line)
+}
+
+// SetDTR sets the DTR modem line.
+func (p *Port) SetDTR(on bool) error {
+	return p.setModemLine(unix.TIOCM_DTR, on)
+}
+
+// SetRTS sets the RTS modem line.
+func (p *Port) SetRTS(on bool) error {
+	return p.setModemLine(unix.TIOCM_RTS, on)
+}
+
+// ModemLines returns the state of the modem lines as TIOCM_* bits.
+func (p *Port) ModemLines() (int, error) {
+	return unix.IoctlGetInt(int(p.f.Fd()), unix.TIOCMGET)
+}
+
+// SetBreak turns the break condition on or off.
+func (p *Port) SetBreak(on bool) error {
+	req := uint(unix.TIOCCBRK)
+	if on {
+		req = unix.TIOCSBRK
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, p.f.Fd(), uintptr(req), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (p *Port) flushQueue(queue int) error {
+	const TCFLSH = 0x540B
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, p.f.Fd(), uintptr(TCFLSH), uintptr(queue))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// FlushInput discards data received but not read.
+func (p *Port) FlushInput() error {
+	return p.flushQueue(unix.TCIFLUSH)
+}
+
+// InputQueued returns the number of bytes received but not read.
+func (p *Port) InputQueued() (int, error) {
+	return unix.IoctlGetInt(int(p.f.Fd()), unix.TIOCINQ)
+}
+
+// FlushOutput discards data written but not transmitted.
+func (p *Port) FlushOutput() error {
+	return p.flushQueue(unix.TCOFLUSH)
+}
+
+// serial_icounter_struct
+type serialIcounter struct {
+	cts, dsr, rng, dcd int32
+	rx, tx             int32
+	frame, overrun     int32
+	parity, brk        int32
+	buf_overrun        int32
+	reserved           [9]int32
+}
+
+// lineCounters returns the line error counters of the driver.
+// Not every driver supports it (e.g. pty).
+func (p *Port) lineCounters() (c serialIcounter, err error) {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, p.f.Fd(), uintptr(unix.TIOCGICOUNT), uintptr(unsafe.Pointer(&c)))
+	if errno != 0 {
+		return c, errno
+	}
+	return c, nil
+}
+
+// Drain waits until the transmitter is empty and returns the time it
+// became empty. It sleeps until the estimated end of transmission, then
+// polls the TEMT bit of the line status register. Drivers without
+// TIOCSERGETLSR (USB adapters, pty) fall back to tcdrain.
+func (p *Port) Drain() (time.Time, error) {
+	sleepUntil(p.txEndAt())
+	fd := int(p.f.Fd())
+	if !p.noLsr {
+		for deadline := time.Now().Add(time.Second); ; {
+			lsr, err := unix.IoctlGetInt(fd, unix.TIOCSERGETLSR)
+			if err != nil {
+				p.noLsr = true
+				break
+			}
+			now := time.Now()
+			if lsr&unix.TIOCSER_TEMT != 0 {
+				p.setTxEnd(now)
+				return now, nil
+			}
+			if now.After(deadline) {
+				return now, unix.ETIMEDOUT
+			}
+		}
+	}
+	// tcdrain
+	if err := unix.IoctlSetInt(fd, unix.TCSBRK, 1); err != nil {
+		return time.Now(), err
+	}
+	now := time.Now()
+	p.setTxEnd(now)
+	return now, nil
+}
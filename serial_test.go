@@ -0,0 +1,61 @@
+package serialport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCharDuration(t *testing.T) {
+	tt := []struct {
+		caseName string
+		baud     int
+		size     byte
+		parity   Parity
+		stop     StopBits
+		expected time.Duration
+	}{
+		{"8N1 9600", 9600, 8, ParityNone, Stop1, 1041666 * time.Nanosecond},
+		{"8E1 9600", 9600, 8, ParityEven, Stop1, 1145833 * time.Nanosecond},
+		{"8N2 9600", 9600, 8, ParityNone, Stop2, 1145833 * time.Nanosecond},
+		{"7E1 1200", 1200, 7, ParityEven, Stop1, 8333333 * time.Nanosecond},
+		{"5N1.5 50", 50, 5, ParityNone, Stop1Half, 150 * time.Millisecond},
+		{"defaults", 115200, 0, 0, 0, 86805 * time.Nanosecond},
+		{"zero baud", 0, 8, ParityNone, Stop1, 0},
+	}
+	for _, tc := range tt {
+		t.Run(tc.caseName, func(t *testing.T) {
+			d := CharDuration(tc.baud, tc.size, tc.parity, tc.stop)
+			if d != tc.expected {
+				t.Errorf("CharDuration %s != %s", d, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFrameGapT35(t *testing.T) {
+	if d := FrameGapT35(9600, 8, ParityEven, Stop1); d != 4010415*time.Nanosecond {
+		t.Errorf("t3.5 9600 8E1: %s", d)
+	}
+	if d := FrameGapT35(115200, 8, ParityNone, Stop1); d != 1750*time.Microsecond {
+		t.Errorf("t3.5 115200: %s", d)
+	}
+}
+
+func TestPortSetTxPacingConcurrent(t *testing.T) {
+	p, _, err := openPty()
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer p.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			p.SetTxPacing(0, time.Duration(i)*time.Microsecond)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		p.Write([]byte{0})
+	}
+	<-done
+}
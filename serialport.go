@@ -1,15 +1,17 @@
 package serialport
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	// распечатка пол  данных
+	// распечатка пол  данных через slog.Default(), если у транспорта не
+	// задан логгер, см. LogConfig
 	LogPrintData = false
 )
 
@@ -32,25 +34,37 @@ const (
 	_ = iota
 	type_serial_stty
 	type_serial_udp
+	type_serial_pty
 )
 
 type SerialPort struct {
-	type_serial int // 1 -type_source_stty,  type_source_udp
+	dataLogger
+	portMetrics
+	bus         busLock     // все обращения к транспорту под шиной
+	connected   atomic.Bool // для Is_connect без захвата шины
+	tx_at       time.Time   // время последней записи, для длительности транзакции
+	type_serial int         // 1 -type_source_stty,  type_source_udp, type_serial_pty
 	stty        *Port
 	config_stty struct {
 		device            string
 		baud              int
 		wait              time.Duration
-		typeRS            int // RS 233/422/485
-		oneSymbolDuration int // длительность одного символа в микросекундах
+		typeRS            LineMode // RS 232/422/485
+		size              byte
+		parity            Parity
+		stopBits          StopBits
+		txCharGap         time.Duration
+		txFrameGap        time.Duration
+		oneSymbolDuration time.Duration // длительность одного символа
 	}
-	ctrlEn ICtrlTxRxEn
+	ctrlEn      ICtrlTxRxEn
+	turnaround  turnaround
+	mode_switch ModeSwitch // переключение режима приемопередатчика
+	echo_cancel bool       // проверять эхо двухпроводного RS-485
 
-	udp_wg          sync.WaitGroup
 	udp_con         *net.UDPConn
 	udp_listen_addr *net.UDPAddr
 	udp_dest_addr   *net.UDPAddr
-	ch_udp_recv     chan []byte
 	config_udp      struct {
 		host        string
 		listen_port uint16
@@ -58,6 +72,19 @@ type SerialPort struct {
 		wait        time.Duration
 	}
 	udp_read_timeout bool
+	udp_read_mode    UdpReadMode
+	udp_read_gap     time.Duration // ожидание следующей датаграммы в UdpReadConcat
+	udp_any_peer     bool          // принимать датаграммы от любого отправителя
+	udp_broadcast    bool
+	udp_multicast    struct {
+		ifname   string
+		ttl      int
+		loopback bool
+	}
+	udp_buf          []byte
+	udp_pending      []byte // датаграмма другого отправителя, отложенная в UdpReadConcat
+	udp_pending_addr *net.UDPAddr
+	udp_last_peer    *net.UDPAddr
 }
 
 func NewSerialPortUdp(host string, listen_port uint16, dest_port uint16, wait time.Duration) (*SerialPort, error) {
@@ -75,61 +102,199 @@ func NewSerialPortUdp(host string, listen_port uint16, dest_port uint16, wait ti
 	if err != nil {
 		return nil, err
 	}
+	serial.log_port = serial.udp_dest_addr.String()
 	return &serial, nil
 }
 
-func NewSerialPortStty(device string, baud int, wait time.Duration, typeRS int, ctrlEn ICtrlTxRxEn) (*SerialPort, error) {
+// NewSerialPortStty creates a port of device in the line mode typeRS.
+// ctrlEn switches the direction in the RS-485 modes, nil for adapters
+// with automatic direction control.
+func NewSerialPortStty(device string, baud int, wait time.Duration, typeRS LineMode, ctrlEn ICtrlTxRxEn) (*SerialPort, error) {
+	if err := typeRS.validate(); err != nil {
+		return nil, err
+	}
 	serial := SerialPort{type_serial: type_serial_stty}
 	serial.config_stty.device = device
 	serial.config_stty.baud = baud
 	serial.config_stty.wait = wait
 	serial.config_stty.typeRS = typeRS
-	serial.config_stty.oneSymbolDuration = 10000000 / baud
+	serial.config_stty.oneSymbolDuration = CharDuration(baud, 0, 0, 0)
 	serial.ctrlEn = ctrlEn
+	serial.log_port = device
 	return &serial, nil
 }
 
+// SetFraming sets data bits, parity and stop bits of the stty port.
+// Zero values mean the Config defaults. Takes effect on next Connect.
+func (s *SerialPort) SetFraming(size byte, parity Parity, stopBits StopBits) {
+	s.acquire()
+	defer s.bus.unlock()
+	s.config_stty.size = size
+	s.config_stty.parity = parity
+	s.config_stty.stopBits = stopBits
+	s.config_stty.oneSymbolDuration = CharDuration(s.config_stty.baud, size, parity, stopBits)
+}
+
+// SetTxPacing sets the inter-character gap and the minimum idle time
+// between frames, see Config.TxCharGap and Config.TxFrameGap.
+func (s *SerialPort) SetTxPacing(charGap, frameGap time.Duration) {
+	s.acquire()
+	defer s.bus.unlock()
+	s.config_stty.txCharGap = charGap
+	s.config_stty.txFrameGap = frameGap
+	if s.stty != nil {
+		s.stty.SetTxPacing(charGap, frameGap)
+	}
+}
+
+// NewSerialPortPty creates a transport on the master side of a new
+// pseudo-terminal. Each Connect allocates a new pair, see PtyName.
+func NewSerialPortPty(wait time.Duration) (*SerialPort, error) {
+	serial := SerialPort{type_serial: type_serial_pty}
+	serial.config_stty.wait = wait
+	return &serial, nil
+}
+
+// PtyName returns the slave device path of a connected pty transport.
+func (s *SerialPort) PtyName() string {
+	if s.type_serial != type_serial_pty {
+		return ""
+	}
+	return s.config_stty.device
+}
+
+// Write sends buf. It waits for the bus if a transaction is running.
 func (s *SerialPort) Write(buf []byte) (int, error) {
-	if LogPrintData {
-		fmt.Printf("Write:%x\n", buf)
+	s.acquire()
+	defer s.bus.unlock()
+	return s.writeTx(buf)
+}
+
+// WriteStream is Write that keeps the data already received and not
+// read, for full-duplex bridging where another goroutine reads the port
+// (see TcpServer). Write discards it to start a request cleanly.
+func (s *SerialPort) WriteStream(buf []byte) (int, error) {
+	s.acquire()
+	defer s.bus.unlock()
+	if s.type_serial != type_serial_stty {
+		return s.writeTx(buf)
 	}
-	switch s.type_serial {
-	case type_serial_stty:
-		s.stty.Flush()
-		if LogPrintData {
-			fmt.Printf("Stty Write:%s %x\n", s.udp_dest_addr, buf)
-		}
-		if s.config_stty.typeRS == 485 {
-			s.ctrlEn.TxEn(true)
-			//time.Sleep(time.Microsecond * 50)
-			s.ctrlEn.RxEn(true)
-		}
+	if s.stty == nil {
+		return 0, net.ErrClosed
+	}
+	return s.accountWrite(s.transmit(buf, false, func() (int, error) {
+		return s.stty.Write(buf)
+	}))
+}
 
-		len_write, err := s.stty.Write(buf)
-		if err != nil {
-			return 0, err
-		}
+func (s *SerialPort) writeTx(buf []byte) (int, error) {
+	return s.accountWrite(s.write(buf))
+}
 
-		time.Sleep(time.Microsecond * time.Duration(s.config_stty.oneSymbolDuration*len_write))
+func (s *SerialPort) accountWrite(n int, err error) (int, error) {
+	if err != nil {
+		s.countErr("write", err)
+		return n, err
+	}
+	s.count(MetricBytes, float64(n), "dir", "write")
+	s.tx_at = time.Now()
+	return n, nil
+}
 
-		if s.config_stty.typeRS == 485 {
-			s.ctrlEn.TxEn(false)
-			//time.Sleep(time.Microsecond * 50)
-			s.ctrlEn.RxEn(false)
+func (s *SerialPort) write(buf []byte) (int, error) {
+	switch s.type_serial {
+	case type_serial_stty:
+		if s.stty == nil {
+			return 0, net.ErrClosed
 		}
-		return len_write, nil
+		return s.transmit(buf, true, func() (int, error) {
+			return s.stty.Write(buf)
+		})
+	case type_serial_pty:
+		if s.stty == nil {
+			return 0, net.ErrClosed
+		}
+		s.logData(DirWrite, buf)
+		return s.stty.Write(buf)
 	case type_serial_udp:
 		//print_time(time.Now().UnixNano())
-		if LogPrintData {
-			fmt.Printf("Udp Write:%s %x\n", s.udp_dest_addr, buf)
+		if s.udp_con == nil {
+			return 0, net.ErrClosed
 		}
+		s.logData(DirWrite, buf)
 		len_write, err := s.udp_con.WriteToUDP(buf, s.udp_dest_addr)
 		if err != nil {
 			return 0, err
 		}
 		return len_write, nil
 	}
-	return 0, fmt.Errorf("error type_source")
+	return 0, &ConfigError{Field: "type_serial", Value: s.type_serial, Err: ErrBadTransport}
+}
+
+// transmit writes frame with fn to the stty port, discarding pending
+// data first if flush is set, and switching the
+// direction as the line mode requires: RS485 drives TxEn and RxEn,
+// RS485FourWire only TxEn (the receiver is always on), RS232 and RS422
+// none.
+func (s *SerialPort) transmit(frame []byte, flush bool, fn func() (int, error)) (int, error) {
+	if flush {
+		s.stty.Flush()
+	}
+	s.logData(DirWrite, frame)
+	mode := s.config_stty.typeRS
+	drive := s.ctrlEn != nil && (mode == RS485 || mode == RS485FourWire)
+	release := func() error {
+		err := s.ctrlEn.TxEn(false)
+		if mode == RS485 {
+			err = errors.Join(err, s.ctrlEn.RxEn(false))
+		}
+		return err
+	}
+	if drive {
+		// без включенного передатчика кадр не уйдет в линию
+		if err := s.ctrlEn.TxEn(true); err != nil {
+			return 0, err
+		}
+		if mode == RS485 {
+			if err := s.ctrlEn.RxEn(true); err != nil {
+				return 0, errors.Join(err, s.ctrlEn.TxEn(false))
+			}
+		}
+		if s.turnaround.preTx > 0 {
+			sleepUntil(time.Now().Add(s.turnaround.preTx))
+		}
+	}
+
+	len_write, err := fn()
+	if err != nil {
+		if drive {
+			err = errors.Join(err, release())
+		}
+		return len_write, err
+	}
+
+	if drive {
+		// точный конец передачи, а не оценка по времени возврата write
+		end, err := s.stty.Drain()
+		if err != nil {
+			return len_write, errors.Join(err, release())
+		}
+		sleepUntil(end.Add(s.turnaround.postTx))
+		if err := release(); err != nil {
+			return len_write, err
+		}
+		d := time.Since(end)
+		s.turnaround.record(d)
+		s.observe(MetricTurnaround, d)
+	} else {
+		s.stty.WaitTxDone()
+	}
+	if mode == RS485 && s.echo_cancel {
+		if err := s.readEcho(frame); err != nil {
+			return len_write, err
+		}
+	}
+	return len_write, nil
 }
 
 func print_time(unix_nano int64) {
@@ -138,138 +303,177 @@ func print_time(unix_nano int64) {
 	fmt.Printf("time:%d.%d\n", time_sec, time_msec-time_sec*1000)
 }
 
+// Read waits for data. It waits for the bus if a transaction is running.
 func (s *SerialPort) Read(buf []byte, estimated_byte int) (int, error) {
+	s.acquire()
+	defer s.bus.unlock()
+	return s.readTx(buf, estimated_byte)
+}
+
+func (s *SerialPort) readTx(buf []byte, estimated_byte int) (int, error) {
+	return s.accountRead(s.read(context.Background(), buf, estimated_byte, s.readWait()))
+}
+
+// accountRead updates the metrics with the result of a Read.
+func (s *SerialPort) accountRead(n int, err error) (int, error) {
+	if err != nil {
+		s.countErr("read", err)
+		return n, err
+	}
+	s.count(MetricBytes, float64(n), "dir", "read")
+	if !s.tx_at.IsZero() {
+		s.observe(MetricTransaction, time.Since(s.tx_at))
+		s.tx_at = time.Time{}
+	}
+	return n, nil
+}
+
+// readWait returns the read timeout of the transport.
+func (s *SerialPort) readWait() time.Duration {
+	if s.type_serial == type_serial_udp {
+		return s.config_udp.wait
+	}
+	return s.config_stty.wait
+}
+
+// read waits up to wait for the first data. The wait for the estimated
+// bytes stops with ctx.Err() when ctx is done.
+func (s *SerialPort) read(ctx context.Context, buf []byte, estimated_byte int, wait time.Duration) (int, error) {
 	switch s.type_serial {
-	case type_serial_stty:
+	case type_serial_stty, type_serial_pty:
+		if s.stty == nil {
+			return 0, net.ErrClosed
+		}
 		if estimated_byte > 0 {
-			//fmt.Println("sleep", time.Microsecond*time.Duration(s.config_stty.oneSymbolDuration*estimated_byte), estimated_byte)
-			time.Sleep(time.Microsecond * time.Duration(s.config_stty.oneSymbolDuration*estimated_byte))
+			t := time.NewTimer(s.config_stty.oneSymbolDuration * time.Duration(estimated_byte))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return 0, ctx.Err()
+			}
 		}
-		if s.stty.Wait(s.config_stty.wait.Milliseconds()) == 0 {
+		// округляем вверх: Wait(0) не ждет, и остаток меньше 1ms крутился бы впустую
+		if s.stty.Wait(int64((wait+time.Millisecond-1)/time.Millisecond)) == 0 {
 			return 0, ErrTimeout
 		}
 		l, err := s.stty.Read(buf)
-		if LogPrintData {
-			log.Printf("Stty Read:%x\n", buf[0:l])
-		}
 		if err != nil {
 			return 0, err
 		}
+		s.logData(DirRead, buf[:l])
 		return l, nil
 	case type_serial_udp:
-
-		s.udp_con.SetReadDeadline(time.Now().Add(s.config_udp.wait))
-		read_len := 0
-		for {
-			n, err := s.udp_con.Read(buf[read_len:])
-			if LogPrintData {
-				fmt.Printf("s.udp_con.Read:%d, %s\n", n, err)
-			}
-			if err != nil {
-				if e, ok := err.(net.Error); !ok || !e.Timeout() {
-					// handle error, it's not a timeout
-				}
-				break
-			}
-			if n == 0 {
-				break
-			}
-			read_len += n
-			// do something with packet here
-		}
-		return read_len, nil
-
-		/*		select {
-				case <-time.After(s.config_udp.wait):
-					return 0, fmt.Errorf("timeout")
-					break
-				case recv_buff := <-s.ch_udp_recv:
-					s.udp_con.SetReadDeadline((time.))
-					copy(buf, recv_buff)
-					if LogPrintData {
-						log.Printf("Udp Read:%x\n", buf[0:len(recv_buff)])
-					}
-					return len(recv_buff), nil
-				}*/
+		return s.readUdp(buf, estimated_byte, wait)
 	}
-	return 0, fmt.Errorf("error type_source")
+	return 0, &ConfigError{Field: "type_serial", Value: s.type_serial, Err: ErrBadTransport}
 }
 
-func (s *SerialPort) recv_udp(wg *sync.WaitGroup) {
-	defer s.udp_wg.Done()
-	buf_in := make([]byte, 1024)
-
-	for {
-		len_msg, _, err := s.udp_con.ReadFromUDP(buf_in)
-		if err != nil {
-			break
-		}
-		s.ch_udp_recv <- buf_in[:len_msg]
-	}
+func (s *SerialPort) Connect() error {
+	s.acquire()
+	defer s.bus.unlock()
+	err := s.connect()
+	s.connected.Store(err == nil)
+	return err
 }
 
-func (s *SerialPort) Connect() error {
+func (s *SerialPort) connect() error {
 	switch s.type_serial {
 	case type_serial_stty:
 		if s.stty != nil {
-			s.Close()
+			s.close()
 		}
 		c := &Config{
 			Name:        s.config_stty.device,
 			Baud:        s.config_stty.baud,
 			ReadTimeout: s.config_stty.wait,
+			Size:        s.config_stty.size,
+			Parity:      s.config_stty.parity,
+			StopBits:    s.config_stty.stopBits,
+			TxCharGap:   s.config_stty.txCharGap,
+			TxFrameGap:  s.config_stty.txFrameGap,
 		}
 		stty, err := OpenPort(c)
 		if err != nil {
 			return err
 		}
 		s.stty = stty
+		if s.mode_switch != nil {
+			if err := s.mode_switch.SetMode(s.config_stty.typeRS); err != nil {
+				s.close()
+				return err
+			}
+		}
+		// управление направлением через линии самого порта
+		if b, ok := s.ctrlEn.(interface{ SetPort(*Port) error }); ok {
+			if err := b.SetPort(stty); err != nil {
+				s.close()
+				return err
+			}
+		}
+	case type_serial_pty:
+		if s.stty != nil {
+			s.close()
+		}
+		pty, name, err := openPty()
+		if err != nil {
+			return err
+		}
+		s.stty = pty
+		s.config_stty.device = name
+		s.log_port = name
 	case type_serial_udp:
 		var err error
 		if s.udp_con != nil {
-			s.udp_con.Close()
+			s.close()
 		}
-		s.udp_con, err = net.ListenUDP("udp", s.udp_listen_addr)
-		//s.udp_con.SetReadDeadline(time.Now().Add(time.Millisecond * 1000))
-		s.ch_udp_recv = make(chan []byte)
+		s.udp_con, err = s.listenUdp()
 		if err != nil {
+			s.udp_con = nil
 			return err
 		}
-		//s.udp_wg.Add(1)
-		//go s.recv_udp(&s.udp_wg)
 	default:
-		return fmt.Errorf("error type_source %d", s.type_serial)
+		return &ConfigError{Field: "type_serial", Value: s.type_serial, Err: ErrBadTransport}
 	}
 	return nil
 }
 
 func (s *SerialPort) Close() error {
+	s.acquire()
+	defer s.bus.unlock()
+	return s.close()
+}
+
+func (s *SerialPort) close() error {
+	s.connected.Store(false)
 	switch s.type_serial {
-	case type_serial_stty:
+	case type_serial_stty, type_serial_pty:
 		if s.stty != nil {
-			return s.stty.Close()
+			err := s.stty.Close()
+			s.stty = nil
+			return err
 		}
 	case type_serial_udp:
 		if s.udp_con != nil {
-			s.udp_con.Close()
-			close(s.ch_udp_recv)
-			s.udp_wg.Wait()
+			err := s.udp_con.Close()
+			s.udp_con = nil
+			s.udp_pending, s.udp_pending_addr = nil, nil
+			return err
 		}
 	}
 	return nil
 }
 
 func (s *SerialPort) Reconnect() error {
-	s.Close()
-	s.Connect()
-	return nil
+	s.acquire()
+	defer s.bus.unlock()
+	s.count(MetricReconnects, 1)
+	s.close()
+	err := s.connect()
+	s.connected.Store(err == nil)
+	return err
 }
 
 func (s *SerialPort) Is_connect() bool {
-	if s.type_serial == type_serial_stty {
-		if s.stty != nil {
-			return true
-		}
-	}
-	return false
+	return s.connected.Load()
 }
@@ -0,0 +1,435 @@
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerPolicy defines how TcpServer shares the port between clients.
+type ServerPolicy int
+
+const (
+	ServerShared    ServerPolicy = iota // все клиенты читают и пишут
+	ServerOneWriter                     // пишет только старейший клиент, остальные читают
+	ServerTakeover                      // новый клиент отключает предыдущих
+	ServerExclusive                     // один клиент, остальные отклоняются
+)
+
+func (p ServerPolicy) String() string {
+	switch p {
+	case ServerShared:
+		return "shared"
+	case ServerOneWriter:
+		return "one-writer"
+	case ServerTakeover:
+		return "takeover"
+	case ServerExclusive:
+		return "exclusive"
+	}
+	return fmt.Sprintf("ServerPolicy(%d)", int(p))
+}
+
+// ParseServerPolicy converts the name returned by ServerPolicy.String.
+func ParseServerPolicy(v string) (ServerPolicy, error) {
+	for p := ServerShared; p <= ServerExclusive; p++ {
+		if strings.EqualFold(v, p.String()) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown server policy %q", v)
+}
+
+// ServerConfig configures TcpServer.
+type ServerConfig struct {
+	Policy ServerPolicy
+
+	// IdleTimeout disconnects a client with no traffic in either
+	// direction for this long. If 0, clients are never disconnected.
+	IdleTimeout time.Duration
+
+	// Allow lists client addresses or CIDR networks that may connect.
+	// If empty, any client is allowed.
+	Allow []string
+}
+
+// PortChannel adapts a Port to ChannelI: Read waits up to Wait for data.
+type PortChannel struct {
+	Port *Port
+	Wait time.Duration
+}
+
+func (c PortChannel) Read(b []byte, e int) (int, error) {
+	if c.Port.Wait(c.Wait.Milliseconds()) == 0 {
+		return 0, ErrTimeout
+	}
+	return c.Port.Read(b)
+}
+
+func (c PortChannel) Write(b []byte) (int, error) {
+	return c.Port.Write(b)
+}
+
+var ErrServerClosed = errors.New("server closed")
+
+const serverClientQueue = 64
+
+// TcpServer shares a local port with TCP clients (ser2net style): data
+// read from the port is sent to every client, data from clients allowed
+// to write by the policy is written to the port.
+type TcpServer struct {
+	dataLogger
+	port  ChannelI
+	cfg   ServerConfig
+	allow []*net.IPNet
+
+	mu        sync.Mutex
+	port_mu   sync.Mutex // запись в порт
+	listeners map[net.Listener]struct{}
+	clients   []*serverClient // в порядке подключения
+	closed    bool
+	done      chan struct{}
+	reader_wg sync.WaitGroup
+	once      sync.Once
+}
+
+type serverClient struct {
+	con    net.Conn
+	out    chan []byte
+	closed chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	activity time.Time
+}
+
+// NewTcpServer creates a server for port. port must return ErrTimeout
+// (or any error) from Read periodically so the server can be stopped.
+func NewTcpServer(port ChannelI, cfg ServerConfig) (*TcpServer, error) {
+	s := &TcpServer{
+		port:      port,
+		cfg:       cfg,
+		listeners: map[net.Listener]struct{}{},
+		done:      make(chan struct{}),
+	}
+	for _, a := range cfg.Allow {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("bad allow address %q", a)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			s.allow = append(s.allow, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, err
+		}
+		s.allow = append(s.allow, n)
+	}
+	return s, nil
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *TcpServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts clients on ln until Close is called. It always returns
+// a non-nil error, ErrServerClosed after Close.
+func (s *TcpServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+	s.once.Do(func() {
+		s.reader_wg.Add(1)
+		go s.readPort()
+	})
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+		ln.Close()
+	}()
+	for {
+		con, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.accept(con)
+	}
+}
+
+// Close stops the listeners, disconnects all clients and waits for the
+// port reader to exit. The port itself is not closed.
+func (s *TcpServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	clients := s.clients
+	s.clients = nil
+	s.mu.Unlock()
+	for _, c := range clients {
+		c.close()
+	}
+	s.reader_wg.Wait()
+	return nil
+}
+
+// Clients returns the remote addresses of connected clients.
+func (s *TcpServer) Clients() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]net.Addr, 0, len(s.clients))
+	for _, c := range s.clients {
+		addrs = append(addrs, c.con.RemoteAddr())
+	}
+	return addrs
+}
+
+func (s *TcpServer) allowed(addr net.Addr) bool {
+	if len(s.allow) == 0 {
+		return true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range s.allow {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TcpServer) accept(con net.Conn) {
+	if !s.allowed(con.RemoteAddr()) {
+		con.Close()
+		return
+	}
+	c := &serverClient{
+		con:      con,
+		out:      make(chan []byte, serverClientQueue),
+		closed:   make(chan struct{}),
+		activity: time.Now(),
+	}
+
+	var dropped []*serverClient
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		con.Close()
+		return
+	}
+	switch s.cfg.Policy {
+	case ServerExclusive:
+		if len(s.clients) > 0 {
+			s.mu.Unlock()
+			con.Close()
+			return
+		}
+	case ServerTakeover:
+		dropped = s.clients
+		s.clients = nil
+	}
+	s.clients = append(s.clients, c)
+	s.mu.Unlock()
+
+	for _, d := range dropped {
+		d.close()
+	}
+	go s.sendLoop(c)
+	go s.recvLoop(c)
+}
+
+func (s *TcpServer) remove(c *serverClient) {
+	s.mu.Lock()
+	for i, cc := range s.clients {
+		if cc == c {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	c.close()
+}
+
+func (s *TcpServer) canWrite(c *serverClient) bool {
+	if s.cfg.Policy != ServerOneWriter {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients) > 0 && s.clients[0] == c
+}
+
+func (s *TcpServer) recvLoop(c *serverClient) {
+	defer s.remove(c)
+	buf := make([]byte, 1024)
+	for {
+		if s.cfg.IdleTimeout > 0 {
+			c.con.SetReadDeadline(c.lastActivity().Add(s.cfg.IdleTimeout))
+		}
+		n, err := c.con.Read(buf)
+		if n > 0 {
+			c.touch()
+			if s.canWrite(c) {
+				s.port_mu.Lock()
+				_, werr := s.writePort(buf[:n])
+				s.port_mu.Unlock()
+				if werr != nil {
+					s.logEvent("port write", slog.String("client", c.con.RemoteAddr().String()), slog.Any("err", werr))
+				}
+			}
+		}
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && time.Since(c.lastActivity()) < s.cfg.IdleTimeout {
+				// был исходящий трафик, продолжаем
+				continue
+			}
+			return
+		}
+	}
+}
+
+// streamWriter is a port whose Write discards received data, with a
+// write that keeps it (SerialPort.WriteStream).
+type streamWriter interface {
+	WriteStream(b []byte) (int, error)
+}
+
+// pollReader is a port whose Read holds it for the whole read timeout,
+// with a read of a given wait (SerialPort.ReadPoll).
+type pollReader interface {
+	ReadPoll(b []byte, wait time.Duration) (int, error)
+}
+
+// serverPoll is the wait of a single port read of the server: the port
+// is released between reads so that client writes get through.
+const serverPoll = 10 * time.Millisecond
+
+// readPortOnce reads the port for readPort.
+func (s *TcpServer) readPortOnce(b []byte) (int, error) {
+	if r, ok := s.port.(pollReader); ok {
+		return r.ReadPoll(b, serverPoll)
+	}
+	return s.port.Read(b, 0)
+}
+
+// writePort writes client data without discarding port data that
+// readPort has not read yet.
+func (s *TcpServer) writePort(b []byte) (int, error) {
+	if w, ok := s.port.(streamWriter); ok {
+		return w.WriteStream(b)
+	}
+	return s.port.Write(b)
+}
+
+func (s *TcpServer) sendLoop(c *serverClient) {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case b := <-c.out:
+			if _, err := c.con.Write(b); err != nil {
+				s.remove(c)
+				return
+			}
+			c.touch()
+		}
+	}
+}
+
+func (s *TcpServer) readPort() {
+	defer s.reader_wg.Done()
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		n, err := s.readPortOnce(buf)
+		if n > 0 {
+			s.broadcast(append([]byte(nil), buf[:n]...))
+		}
+		if err != nil && !errors.Is(err, ErrTimeout) {
+			// не даем крутиться вхолостую при ошибке порта
+			select {
+			case <-s.done:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+}
+
+func (s *TcpServer) broadcast(b []byte) {
+	s.mu.Lock()
+	clients := append([]*serverClient(nil), s.clients...)
+	s.mu.Unlock()
+	for _, c := range clients {
+		select {
+		case c.out <- b:
+		default:
+			// медленный клиент
+			s.remove(c)
+		}
+	}
+}
+
+func (c *serverClient) touch() {
+	c.mu.Lock()
+	c.activity = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *serverClient) lastActivity() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.activity
+}
+
+func (c *serverClient) close() {
+	c.once.Do(func() {
+		close(c.closed)
+		c.con.Close()
+	})
+}
@@ -0,0 +1,205 @@
+package serialport
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// сервер на мастере pty, устройство - слейв
+func startPtyServer(t *testing.T, cfg ServerConfig) (*TcpServer, PortChannel, string) {
+	t.Helper()
+	master, err := NewSerialPortPty(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Connect(); err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { slave.Close() })
+
+	srv, err := NewTcpServer(master, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return srv, PortChannel{Port: slave, Wait: 500 * time.Millisecond}, ln.Addr().String()
+}
+
+func dialServer(t *testing.T, addr string) *SerialTcp {
+	t.Helper()
+	c, _ := NewSerialTcp(addr, 300*time.Millisecond)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func waitClients(srv *TcpServer, n int) bool {
+	for i := 0; i < 100; i++ {
+		if len(srv.Clients()) == n {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestTcpServerOneWriter(t *testing.T) {
+	srv, dev, addr := startPtyServer(t, ServerConfig{Policy: ServerOneWriter})
+	writer := dialServer(t, addr)
+	if !waitClients(srv, 1) {
+		t.Fatal("клиент не подключен")
+	}
+	reader := dialServer(t, addr)
+	if !waitClients(srv, 2) {
+		t.Fatal("клиент не подключен")
+	}
+
+	reader.Write([]byte{0xAA})
+	writer.Write([]byte{0x01, 0x02})
+	buf := make([]byte, 16)
+	n, err := dev.Read(buf, 0)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x01, 0x02}) {
+		t.Errorf("устройство получило %X %v", buf[:n], err)
+	}
+
+	dev.Write([]byte{0x03, 0x04})
+	for _, c := range []*SerialTcp{writer, reader} {
+		n, err := c.Read(buf, 2)
+		if err != nil || !bytes.Equal(buf[:n], []byte{0x03, 0x04}) {
+			t.Errorf("клиент получил %X %v", buf[:n], err)
+		}
+	}
+}
+
+func TestTcpServerTakeover(t *testing.T) {
+	srv, _, addr := startPtyServer(t, ServerConfig{Policy: ServerTakeover})
+	first := dialServer(t, addr)
+	if !waitClients(srv, 1) {
+		t.Fatal("клиент не подключен")
+	}
+	dialServer(t, addr)
+	time.Sleep(20 * time.Millisecond)
+	if !waitClients(srv, 1) {
+		t.Errorf("clients %v", srv.Clients())
+	}
+	buf := make([]byte, 4)
+	if _, err := first.Read(buf, 0); err == nil || err == ErrTimeout {
+		t.Errorf("первый клиент должен быть отключен, err %v", err)
+	}
+}
+
+func TestTcpServerIdleAndAllow(t *testing.T) {
+	srv, _, addr := startPtyServer(t, ServerConfig{IdleTimeout: 50 * time.Millisecond, Allow: []string{"127.0.0.1"}})
+	dialServer(t, addr)
+	if !waitClients(srv, 1) {
+		t.Fatal("клиент не подключен")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if !waitClients(srv, 0) {
+		t.Errorf("клиент не отключен по простою: %v", srv.Clients())
+	}
+
+	if _, err := NewTcpServer(nil, ServerConfig{Allow: []string{"bad"}}); err == nil {
+		t.Error("ожидается ошибка allow")
+	}
+	s, _ := NewTcpServer(nil, ServerConfig{Allow: []string{"10.0.0.0/8"}})
+	if s.allowed(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")}) {
+		t.Error("127.0.0.1 не должен быть разрешен")
+	}
+	if !s.allowed(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}) {
+		t.Error("10.1.2.3 должен быть разрешен")
+	}
+}
+
+func TestSerialPortWriteStream(t *testing.T) {
+	master, s := ptyStty(t, RS232, nil)
+	master.Write([]byte{0xAA})
+	time.Sleep(10 * time.Millisecond)
+	if _, err := s.WriteStream([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if n, err := s.Read(buf, 0); err != nil || n != 1 || buf[0] != 0xAA {
+		t.Errorf("принятые данные потеряны: % X %v", buf[:n], err)
+	}
+
+	// Write начинает запрос с чистого буфера
+	master.Write([]byte{0xBB})
+	time.Sleep(10 * time.Millisecond)
+	s.Write([]byte{2})
+	if n, err := s.Read(buf, 0); err == nil {
+		t.Errorf("ожидался пустой буфер: % X", buf[:n])
+	}
+}
+
+func TestPortConcurrentReadWrite(t *testing.T) {
+	_, dev, _ := startPtyServer(t, ServerConfig{})
+	dev.Port.SetTxPacing(0, time.Microsecond)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 16)
+		for i := 0; i < 20; i++ {
+			PortChannel{Port: dev.Port, Wait: 5 * time.Millisecond}.Read(buf, 0)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		dev.Write([]byte{byte(i)})
+	}
+	<-done
+}
+
+func TestTcpServerWriteLatency(t *testing.T) {
+	// таймаут чтения порта больше допустимой задержки записи
+	master, err := NewSerialPortPty(2 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Connect(); err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	slave, err := OpenPort(&Config{Name: master.PtyName(), Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+	srv, err := NewTcpServer(master, ServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+	c := dialServer(t, ln.Addr().String())
+	if !waitClients(srv, 1) {
+		t.Fatal("клиент не подключен")
+	}
+	time.Sleep(50 * time.Millisecond) // readPort ждет данных порта
+	start := time.Now()
+	c.Write([]byte{0x01})
+	n, err := PortChannel{Port: slave, Wait: time.Second}.Read(make([]byte, 4), 0)
+	if err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Error("запись клиента ждала чтения порта:", d)
+	}
+}
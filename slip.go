@@ -1,9 +1,5 @@
 package serialport
 
-import (
-	"fmt"
-)
-
 type ChannelI interface {
 	Read(b []byte, e int) (int, error)
 	Write(b []byte) (int, error)
@@ -30,11 +26,11 @@ func SlipWrite(ch_i ChannelI, buf []byte) (int, error) {
 	out_len := 2
 	write_buf[0] = COD_FLUSH
 	write_buf[1] = COD_END
-	for _, c := range buf {
+	for i, c := range buf {
 		switch c {
 		case COD_END:
 			if out_len+2 > BUF_SIZE {
-				return 0, fmt.Errorf("write buf %d size exceeded %d", BUF_SIZE, out_len)
+				return 0, &SlipError{Err: ErrBufferOverflow, Pos: i, Byte: c}
 			}
 			write_buf[out_len] = COD_ESC
 			out_len++
@@ -42,7 +38,7 @@ func SlipWrite(ch_i ChannelI, buf []byte) (int, error) {
 			out_len++
 		case COD_ESC:
 			if out_len+2 > BUF_SIZE {
-				return 0, fmt.Errorf("write buf %d size exceeded %d", BUF_SIZE, out_len)
+				return 0, &SlipError{Err: ErrBufferOverflow, Pos: i, Byte: c}
 			}
 			write_buf[out_len] = COD_ESC
 			out_len++
@@ -50,14 +46,14 @@ func SlipWrite(ch_i ChannelI, buf []byte) (int, error) {
 			out_len++
 		default:
 			if out_len+1 > BUF_SIZE {
-				return 0, fmt.Errorf("write buf %d size exceeded %d", BUF_SIZE, out_len)
+				return 0, &SlipError{Err: ErrBufferOverflow, Pos: i, Byte: c}
 			}
 			write_buf[out_len] = c
 			out_len++
 		}
 	}
 	if out_len+1 > BUF_SIZE {
-		return 0, fmt.Errorf("write buf %d size exceeded %d", BUF_SIZE, out_len)
+		return 0, &SlipError{Err: ErrBufferOverflow, Pos: len(buf), Byte: COD_END}
 	}
 	write_buf[out_len] = COD_END
 	out_len++
@@ -65,10 +61,27 @@ func SlipWrite(ch_i ChannelI, buf []byte) (int, error) {
 }
 
 type Slip struct {
+	portMetrics
 	read_cache_buf     [BUF_SIZE]byte
 	len_read_cahce_buf int
+	skip_frame         bool // после ошибки отбрасываем байты до конца кадра
+}
+
+// SlipWrite is SlipWrite counting the sent frame in the metrics.
+func (s *Slip) SlipWrite(ch_i ChannelI, buf []byte) (int, error) {
+	n, err := SlipWrite(ch_i, buf)
+	if err != nil {
+		s.countErr("write", err)
+		return n, err
+	}
+	s.count(MetricFrames, 1, "dir", "write")
+	return n, nil
 }
 
+// SlipRead reads one frame into buf and returns its length and the
+// number of bytes left for the next call. A bad escape or a frame
+// longer than buf is returned as *SlipError with the position in the
+// frame; the rest of that frame is skipped.
 func (s *Slip) SlipRead(ch_i ChannelI, buf []byte, e int) (int, int, error) {
 	/*var read_cache_buf [BUF_SIZE]byte
 	var len_read_cahce_buf int*/
@@ -92,6 +105,7 @@ func (s *Slip) SlipRead(ch_i ChannelI, buf []byte, e int) (int, int, error) {
 					s.len_read_cahce_buf = len(buf_tmp[:len_read])
 					copy(s.read_cache_buf[:], buf_tmp[:len_read])
 				}
+				s.countErr("read", err)
 				return 0, len_read, err
 			} else {
 				ret = nread
@@ -99,11 +113,20 @@ func (s *Slip) SlipRead(ch_i ChannelI, buf []byte, e int) (int, int, error) {
 		}
 		if ret > 0 {
 			for idx, c := range buf_tmp[:ret] {
+				if s.skip_frame {
+					if c == COD_END {
+						s.skip_frame = false
+					}
+					continue
+				}
 				switch c {
 				case COD_ESC:
 					lastc = c
 				case COD_END:
 					lastc = 0
+					if len_read > 0 {
+						s.count(MetricFrames, 1, "dir", "read")
+					}
 					left_byte := ret - (idx + 1)
 					if left_byte > 0 {
 						s.len_read_cahce_buf = left_byte
@@ -119,12 +142,16 @@ func (s *Slip) SlipRead(ch_i ChannelI, buf []byte, e int) (int, int, error) {
 							c = COD_END
 						case ESC_ESC:
 							c = COD_ESC
+						default:
+							s.count(MetricSlipErrors, 1, "kind", "escape")
+							return s.badFrame(&SlipError{Err: ErrUnknownEscapedByte, Pos: len_read, Byte: c}, buf_tmp[idx+1:ret])
 						}
 					} else {
 						lastc = c
 					}
-					if len_read > BUF_SIZE {
-						len_read = 0
+					if len_read >= len(buf) {
+						s.count(MetricSlipErrors, 1, "kind", "overflow")
+						return s.badFrame(&SlipError{Err: ErrBufferOverflow, Pos: len_read, Byte: c}, buf_tmp[idx+1:ret])
 					}
 					buf[len_read] = c
 					len_read++
@@ -142,6 +169,14 @@ func (s *Slip) SlipRead(ch_i ChannelI, buf []byte, e int) (int, int, error) {
 	// return len_read, nil
 }
 
+// badFrame drops the frame with a decoding error: the rest of it up to
+// END is skipped, left bytes are kept for the next SlipRead.
+func (s *Slip) badFrame(err *SlipError, left []byte) (int, int, error) {
+	s.skip_frame = true
+	s.len_read_cahce_buf = copy(s.read_cache_buf[:], left)
+	return 0, len(left), err
+}
+
 func SlipPack(buf []byte) []byte {
 	var write_buf [BUF_SIZE]byte
 	out_len := 2
@@ -25,6 +25,7 @@ var ErrBufferOverflow = errors.New("SLIP_ERROR_BUFFER_OVERFLOW")
 var ErrUnknownEscapedByte = errors.New("SLIP_ERROR_UNKNOWN_ESCAPED_BYTE")
 
 type SlipReadByte struct {
+	portMetrics
 	buf          []byte
 	size         int
 	state        int
@@ -46,7 +47,8 @@ func (s *SlipReadByte) reset_rx() {
 func (s *SlipReadByte) put_byte_to_buffer(value byte) error {
 	var err error
 	if s.size >= len(s.buf) {
-		err = ErrBufferOverflow
+		err = &SlipError{Err: ErrBufferOverflow, Pos: s.size, Byte: value}
+		s.count(MetricSlipErrors, 1, "kind", "overflow")
 		s.reset_rx()
 	} else {
 		s.buf[s.size] = value
@@ -63,6 +65,7 @@ func (s *SlipReadByte) Readbyte(value byte) error {
 		switch value {
 		case SLIP_SPECIAL_BYTE_END:
 			if s.size >= 2 {
+				s.count(MetricFrames, 1, "dir", "read")
 				s.recv_message(s.buf, s.size)
 			}
 			s.reset_rx()
@@ -78,7 +81,8 @@ func (s *SlipReadByte) Readbyte(value byte) error {
 		case SLIP_ESCAPED_BYTE_ESC:
 			value = SLIP_SPECIAL_BYTE_ESC
 		default:
-			err = ErrUnknownEscapedByte
+			err = &SlipError{Err: ErrUnknownEscapedByte, Pos: s.size, Byte: value}
+			s.count(MetricSlipErrors, 1, "kind", "escape")
 			s.reset_rx()
 		}
 
@@ -91,6 +95,12 @@ func (s *SlipReadByte) Readbyte(value byte) error {
 	return err
 }
 
+// CrcMismatch counts a frame rejected by the receiver callback because
+// of a bad checksum.
+func (s *SlipReadByte) CrcMismatch() {
+	s.count(MetricSlipErrors, 1, "kind", "crc")
+}
+
 type SlipWriteByte struct {
 	buf          []byte
 	size         int
@@ -112,7 +122,7 @@ func (s *SlipWriteByte) Reset() {
 func (s *SlipWriteByte) put_byte_to_buffer(value byte) error {
 	var err error
 	if s.size >= len(s.buf) {
-		err = ErrBufferOverflow
+		err = &SlipError{Err: ErrBufferOverflow, Pos: s.size, Byte: value}
 		s.Reset()
 	} else {
 		s.buf[s.size] = value
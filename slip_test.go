@@ -2,6 +2,7 @@ package serialport
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -208,3 +209,45 @@ func TestSlip(t *testing.T) {
 		}
 	}
 }
+
+func TestSlipReadError(t *testing.T) {
+	data := []byte{0xC0, 1, COD_ESC, 0x11, 2, 0xC0, 3, 4, 0xC0, 5, 6, 7, 8, 9, 0xC0, 0x0A, 0xC0}
+	sent := false
+	mock := Mock{MockRead: func(b []byte, e int) (int, error) {
+		if sent {
+			return 0, nil
+		}
+		sent = true
+		return copy(b, data), nil
+	}}
+	slip := Slip{}
+	buf := make([]byte, 4)
+	type frame struct {
+		data []byte
+		err  error
+		pos  int
+	}
+	var frames []frame
+	for i := 0; i < 10; i++ {
+		n, left, err := slip.SlipRead(&mock, buf, 0)
+		var se *SlipError
+		switch {
+		case errors.As(err, &se):
+			frames = append(frames, frame{err: se.Err, pos: se.Pos})
+		case n > 0:
+			frames = append(frames, frame{data: append([]byte{}, buf[:n]...)})
+		}
+		if n == 0 && left == 0 && err == nil {
+			break
+		}
+	}
+	want := []frame{
+		{err: ErrUnknownEscapedByte, pos: 1},
+		{data: []byte{3, 4}},
+		{err: ErrBufferOverflow, pos: 4},
+		{data: []byte{0x0A}},
+	}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("кадры %+v", frames)
+	}
+}
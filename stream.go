@@ -0,0 +1,38 @@
+package serialport
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// deadlineReader is a byte stream with read deadlines: net.Conn or a pipe *os.File.
+type deadlineReader interface {
+	Read(b []byte) (int, error)
+	SetReadDeadline(t time.Time) error
+}
+
+// readStream reads until estimated_byte bytes are received or the
+// deadline passes. With estimated_byte <= 0 the first received chunk is
+// returned. ErrTimeout is returned only if nothing was received.
+func readStream(r deadlineReader, buf []byte, estimated_byte int, deadline time.Time) (int, error) {
+	r.SetReadDeadline(deadline)
+	read_len := 0
+	for read_len < len(buf) {
+		n, err := r.Read(buf[read_len:])
+		read_len += n
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				if read_len == 0 {
+					return 0, ErrTimeout
+				}
+				break
+			}
+			return read_len, err
+		}
+		if read_len >= estimated_byte {
+			break
+		}
+	}
+	return read_len, nil
+}
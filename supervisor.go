@@ -0,0 +1,378 @@
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConnState is the state of a supervised connection.
+type ConnState int
+
+const (
+	StateDisconnected ConnState = iota
+	StateConnecting
+	StateConnected
+	StateDegraded // подключен, но устройство не отвечает
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDegraded:
+		return "degraded"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+// ErrorClass is the class of a transport error, see ClassifyError.
+type ErrorClass int
+
+const (
+	ErrorNone       ErrorClass = iota
+	ErrorTimeout               // устройство не ответило
+	ErrorDisconnect            // устройство или соединение пропало
+	ErrorOther
+)
+
+// ClassifyError tells timeouts from errors meaning that the device is
+// gone: EIO/ENXIO/ENODEV after a USB unplug, hangup (EOF), closed or
+// reset connections. ErrNoPeer of a listener still waiting for its peer
+// counts as a timeout.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorNone
+	}
+	var ne net.Error
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrNoPeer) || errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return ErrorTimeout
+	}
+	for _, e := range []error{
+		ErrDisconnected, io.EOF, io.ErrUnexpectedEOF, net.ErrClosed, os.ErrClosed,
+		syscall.EIO, syscall.ENXIO, syscall.ENODEV, syscall.ENOENT, syscall.EBADF,
+		syscall.EPIPE, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED,
+	} {
+		if errors.Is(err, e) {
+			return ErrorDisconnect
+		}
+	}
+	return ErrorOther
+}
+
+// ErrNotConnected is returned by a Supervisor while it is reconnecting.
+var ErrNotConnected = errors.New("not connected")
+
+// StateEvent is a state change of a Supervisor.
+type StateEvent struct {
+	From, To ConnState
+	Err      error // причина перехода, если есть
+	Attempt  int   // номер неудачной попытки подключения подряд
+	At       time.Time
+}
+
+// SupervisorConfig configures a Supervisor. Zero values select defaults.
+type SupervisorConfig struct {
+	MinBackoff time.Duration // 100ms
+	MaxBackoff time.Duration // 30s
+	Multiplier float64       // 2
+	Jitter     float64       // доля случайного отклонения задержки, 0.2
+
+	// Timeouts in a row that make the connection degraded, 3 by default.
+	DegradedTimeouts int
+	// Timeouts in a row that force a reconnect, 0 - never.
+	ReconnectTimeouts int
+}
+
+// Supervisor wraps a transport and keeps it connected. Errors of Read
+// and Write meaning that the device is gone start reconnecting in the
+// background with exponential backoff; meanwhile Read and Write return
+// ErrNotConnected. The transport is only used by one call at a time.
+type Supervisor struct {
+	s   InterfaceSerial
+	cfg SupervisorConfig
+
+	io_mu sync.Mutex // вызовы транспорта
+
+	mu        sync.Mutex
+	state     ConnState
+	timeouts  int
+	attempt   int
+	running   bool
+	wake      chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+	listeners []func(StateEvent)
+	events    []StateEvent // очередь на доставку
+
+	event_mu sync.Mutex // доставка событий по порядку
+	rand     *rand.Rand
+}
+
+// NewSupervisor creates a supervisor of s. It does nothing until Connect.
+func NewSupervisor(s InterfaceSerial, cfg SupervisorConfig) *Supervisor {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 2
+	}
+	if cfg.Jitter <= 0 {
+		cfg.Jitter = 0.2
+	}
+	if cfg.DegradedTimeouts <= 0 {
+		cfg.DegradedTimeouts = 3
+	}
+	return &Supervisor{
+		s:    s,
+		cfg:  cfg,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// OnStateChange adds a listener of state changes. Listeners are called
+// in the order of the changes, outside of transport calls.
+func (v *Supervisor) OnStateChange(f func(StateEvent)) {
+	v.mu.Lock()
+	v.listeners = append(v.listeners, f)
+	v.mu.Unlock()
+}
+
+// State returns the current state.
+func (v *Supervisor) State() ConnState {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.state
+}
+
+// Unwrap returns the supervised transport.
+func (v *Supervisor) Unwrap() InterfaceSerial {
+	return v.s
+}
+
+// setState changes the state, v.mu must be held. The event is delivered
+// by deliver after unlocking.
+func (v *Supervisor) setState(to ConnState, err error) {
+	if v.state == to {
+		return
+	}
+	v.events = append(v.events, StateEvent{From: v.state, To: to, Err: err, Attempt: v.attempt, At: time.Now()})
+	v.state = to
+}
+
+func (v *Supervisor) deliver() {
+	v.event_mu.Lock()
+	defer v.event_mu.Unlock()
+	for {
+		v.mu.Lock()
+		if len(v.events) == 0 {
+			v.mu.Unlock()
+			return
+		}
+		e := v.events[0]
+		v.events = v.events[1:]
+		listeners := v.listeners
+		v.mu.Unlock()
+		for _, f := range listeners {
+			f(e)
+		}
+	}
+}
+
+// backoff returns the delay before the attempt-th reconnect.
+func (v *Supervisor) backoff(attempt int) time.Duration {
+	d := float64(v.cfg.MinBackoff)
+	for i := 1; i < attempt && d < float64(v.cfg.MaxBackoff); i++ {
+		d *= v.cfg.Multiplier
+	}
+	if d > float64(v.cfg.MaxBackoff) {
+		d = float64(v.cfg.MaxBackoff)
+	}
+	v.mu.Lock()
+	d += d * v.cfg.Jitter * (2*v.rand.Float64() - 1)
+	v.mu.Unlock()
+	return time.Duration(d)
+}
+
+// connect makes one attempt under io_mu.
+func (v *Supervisor) connect() error {
+	v.mu.Lock()
+	v.setState(StateConnecting, nil)
+	v.mu.Unlock()
+	v.deliver()
+
+	v.io_mu.Lock()
+	v.s.Close()
+	err := v.s.Connect()
+	v.io_mu.Unlock()
+
+	v.mu.Lock()
+	if err != nil {
+		v.attempt++
+		v.setState(StateDisconnected, err)
+	} else {
+		v.attempt = 0
+		v.timeouts = 0
+		v.setState(StateConnected, nil)
+	}
+	v.mu.Unlock()
+	v.deliver()
+	return err
+}
+
+func (v *Supervisor) loop(wake, done chan struct{}) {
+	defer v.wg.Done()
+	for {
+		select {
+		case <-done:
+			return
+		case <-wake:
+		}
+		for {
+			v.mu.Lock()
+			state, attempt := v.state, v.attempt
+			v.mu.Unlock()
+			if state != StateDisconnected {
+				break
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(v.backoff(attempt)):
+			}
+			v.connect()
+		}
+	}
+}
+
+// Connect connects the transport and starts supervising it. If the
+// first attempt fails, its error is returned and reconnecting goes on in
+// the background.
+func (v *Supervisor) Connect() error {
+	v.mu.Lock()
+	if !v.running {
+		v.running = true
+		v.wake = make(chan struct{}, 1)
+		v.done = make(chan struct{})
+		v.wg.Add(1)
+		go v.loop(v.wake, v.done)
+	}
+	v.mu.Unlock()
+	err := v.connect()
+	if err != nil {
+		v.kick()
+	}
+	return err
+}
+
+func (v *Supervisor) kick() {
+	v.mu.Lock()
+	if v.running {
+		select {
+		case v.wake <- struct{}{}:
+		default:
+		}
+	}
+	v.mu.Unlock()
+}
+
+// Close stops supervising and closes the transport.
+func (v *Supervisor) Close() error {
+	v.mu.Lock()
+	if v.running {
+		v.running = false
+		close(v.done)
+	}
+	v.mu.Unlock()
+	v.wg.Wait()
+
+	v.io_mu.Lock()
+	err := v.s.Close()
+	v.io_mu.Unlock()
+
+	v.mu.Lock()
+	v.setState(StateDisconnected, nil)
+	v.mu.Unlock()
+	v.deliver()
+	return err
+}
+
+// Reconnect reconnects the transport now.
+func (v *Supervisor) Reconnect() error {
+	err := v.connect()
+	if err != nil {
+		v.kick()
+	}
+	return err
+}
+
+// Is_connect reports whether the state is connected or degraded.
+func (v *Supervisor) Is_connect() bool {
+	state := v.State()
+	return state == StateConnected || state == StateDegraded
+}
+
+// result updates the state with the result of a Read or Write.
+func (v *Supervisor) result(err error) {
+	v.mu.Lock()
+	switch ClassifyError(err) {
+	case ErrorNone:
+		v.timeouts = 0
+		if v.state == StateDegraded {
+			v.setState(StateConnected, nil)
+		}
+	case ErrorTimeout:
+		v.timeouts++
+		if v.cfg.ReconnectTimeouts > 0 && v.timeouts >= v.cfg.ReconnectTimeouts {
+			v.setState(StateDisconnected, err)
+		} else if v.timeouts >= v.cfg.DegradedTimeouts && v.state == StateConnected {
+			v.setState(StateDegraded, err)
+		}
+	case ErrorDisconnect:
+		v.setState(StateDisconnected, err)
+	}
+	disconnected := v.state == StateDisconnected
+	v.mu.Unlock()
+	v.deliver()
+	if disconnected {
+		v.kick()
+	}
+}
+
+func (v *Supervisor) Read(b []byte, estimated_byte int) (int, error) {
+	if !v.Is_connect() {
+		return 0, ErrNotConnected
+	}
+	v.io_mu.Lock()
+	n, err := v.s.Read(b, estimated_byte)
+	v.io_mu.Unlock()
+	v.result(err)
+	return n, err
+}
+
+func (v *Supervisor) Write(b []byte) (int, error) {
+	if !v.Is_connect() {
+		return 0, ErrNotConnected
+	}
+	v.io_mu.Lock()
+	n, err := v.s.Write(b)
+	v.io_mu.Unlock()
+	v.result(err)
+	return n, err
+}
@@ -0,0 +1,171 @@
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakySerial - транспорт с заданными ошибками
+type flakySerial struct {
+	mu          sync.Mutex
+	connected   bool
+	connects    int
+	connectErrs []error // ошибки очередных Connect
+	readErrs    []error // ошибки очередных Read
+}
+
+func (f *flakySerial) Connect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connects++
+	if len(f.connectErrs) > 0 {
+		err := f.connectErrs[0]
+		f.connectErrs = f.connectErrs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	f.connected = true
+	return nil
+}
+
+func (f *flakySerial) Close() error {
+	f.mu.Lock()
+	f.connected = false
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *flakySerial) Reconnect() error { f.Close(); return f.Connect() }
+
+func (f *flakySerial) Is_connect() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+func (f *flakySerial) Read(b []byte, e int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.readErrs) > 0 {
+		err := f.readErrs[0]
+		f.readErrs = f.readErrs[1:]
+		if err != nil {
+			return 0, err
+		}
+	}
+	return copy(b, "ok"), nil
+}
+
+func (f *flakySerial) Write(b []byte) (int, error) { return len(b), nil }
+
+func TestClassifyError(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want ErrorClass
+	}{
+		{nil, ErrorNone},
+		{ErrTimeout, ErrorTimeout},
+		{os.ErrDeadlineExceeded, ErrorTimeout},
+		{ErrNoPeer, ErrorTimeout},
+		{&os.PathError{Op: "read", Path: "/dev/ttyUSB0", Err: syscall.EIO}, ErrorDisconnect},
+		{fmt.Errorf("open: %w", syscall.ENXIO), ErrorDisconnect},
+		{io.EOF, ErrorDisconnect},
+		{errors.New("crc"), ErrorOther},
+	} {
+		if got := ClassifyError(c.err); got != c.want {
+			t.Errorf("%v: %d, ожидалось %d", c.err, got, c.want)
+		}
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	v := NewSupervisor(&flakySerial{}, SupervisorConfig{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.1})
+	for _, c := range []struct {
+		attempt int
+		base    time.Duration
+	}{{1, 100 * time.Millisecond}, {2, 200 * time.Millisecond}, {4, 800 * time.Millisecond}, {10, time.Second}} {
+		for i := 0; i < 20; i++ {
+			d := v.backoff(c.attempt)
+			if d < c.base*9/10 || d > c.base*11/10 {
+				t.Errorf("попытка %d: задержка %s вне %s±10%%", c.attempt, d, c.base)
+			}
+		}
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	dev := &flakySerial{
+		connectErrs: []error{syscall.ENOENT, syscall.ENOENT},
+		readErrs:    []error{ErrTimeout, ErrTimeout, nil, syscall.EIO},
+	}
+	v := NewSupervisor(dev, SupervisorConfig{MinBackoff: 5 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, DegradedTimeouts: 2})
+	events := make(chan StateEvent, 32)
+	v.OnStateChange(func(e StateEvent) { events <- e })
+	expect := func(to ConnState) StateEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.To != to {
+				t.Fatalf("переход %s -> %s, ожидался %s", e.From, e.To, to)
+			}
+			return e
+		case <-time.After(time.Second):
+			t.Fatalf("нет перехода в %s", to)
+		}
+		return StateEvent{}
+	}
+
+	if err := v.Connect(); !errors.Is(err, syscall.ENOENT) {
+		t.Fatalf("err %v", err)
+	}
+	defer v.Close()
+	expect(StateConnecting)
+	if e := expect(StateDisconnected); e.Attempt != 1 || e.Err == nil {
+		t.Errorf("событие %+v", e)
+	}
+	buf := make([]byte, 8)
+	if _, err := v.Read(buf, 0); err != ErrNotConnected {
+		t.Errorf("ожидается ErrNotConnected, получено %v", err)
+	}
+	expect(StateConnecting)
+	expect(StateDisconnected)
+	expect(StateConnecting)
+	expect(StateConnected)
+
+	v.Read(buf, 0)
+	v.Read(buf, 0)
+	expect(StateDegraded)
+	if !v.Is_connect() {
+		t.Error("degraded должен считаться подключенным")
+	}
+	if n, err := v.Read(buf, 0); err != nil || string(buf[:n]) != "ok" {
+		t.Fatalf("read %q %v", buf[:n], err)
+	}
+	expect(StateConnected)
+
+	// устройство отключено
+	if _, err := v.Read(buf, 0); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("err %v", err)
+	}
+	expect(StateDisconnected)
+	expect(StateConnecting)
+	expect(StateConnected)
+	dev.mu.Lock()
+	if dev.connects != 4 {
+		t.Errorf("подключений %d", dev.connects)
+	}
+	dev.mu.Unlock()
+
+	v.Close()
+	expect(StateDisconnected)
+	if dev.Is_connect() {
+		t.Error("транспорт не закрыт")
+	}
+}
@@ -0,0 +1,176 @@
+package serialport
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SerialTcp is a transport to a serial device server in raw TCP mode
+// (Moxa, USR and similar).
+type SerialTcp struct {
+	dataLogger
+	con        net.Conn
+	config_tcp struct {
+		addr              string
+		wait              time.Duration // ожидание первого байта ответа
+		connectTimeout    time.Duration
+		keepAlive         time.Duration // <0 - выключен, 0 - по умолчанию
+		noDelay           bool
+		oneSymbolDuration time.Duration // длительность символа на стороне сервера
+	}
+}
+
+func init() {
+	RegisterScheme("tcp", openTcpURL)
+}
+
+// NewSerialTcp creates a TCP transport to addr ("host:port").
+// wait is the time to wait for the first byte in Read.
+func NewSerialTcp(addr string, wait time.Duration) (*SerialTcp, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+	serial := SerialTcp{}
+	serial.config_tcp.addr = addr
+	serial.config_tcp.wait = wait
+	serial.config_tcp.connectTimeout = 5 * time.Second
+	serial.config_tcp.noDelay = true
+	serial.log_port = addr
+	return &serial, nil
+}
+
+// SetConnectTimeout limits the time of establishing the connection.
+func (s *SerialTcp) SetConnectTimeout(d time.Duration) {
+	s.config_tcp.connectTimeout = d
+}
+
+// SetKeepAlive sets the TCP keep-alive period. Negative disables it,
+// zero uses the system default. Takes effect on next Connect.
+func (s *SerialTcp) SetKeepAlive(d time.Duration) {
+	s.config_tcp.keepAlive = d
+}
+
+// SetNoDelay controls TCP_NODELAY (enabled by default).
+func (s *SerialTcp) SetNoDelay(noDelay bool) {
+	s.config_tcp.noDelay = noDelay
+	if c, ok := s.con.(*net.TCPConn); ok {
+		c.SetNoDelay(noDelay)
+	}
+}
+
+// SetBaud sets the line speed on the device server side, used to extend
+// the read deadline by the transmission time of estimated_byte.
+func (s *SerialTcp) SetBaud(baud int) {
+	s.config_tcp.oneSymbolDuration = CharDuration(baud, 0, 0, 0)
+}
+
+func (s *SerialTcp) Connect() error {
+	if s.con != nil {
+		s.Close()
+	}
+	d := net.Dialer{
+		Timeout:   s.config_tcp.connectTimeout,
+		KeepAlive: s.config_tcp.keepAlive,
+	}
+	con, err := d.Dial("tcp", s.config_tcp.addr)
+	if err != nil {
+		return err
+	}
+	if c, ok := con.(*net.TCPConn); ok {
+		if err := c.SetNoDelay(s.config_tcp.noDelay); err != nil {
+			con.Close()
+			return err
+		}
+	}
+	s.con = con
+	return nil
+}
+
+func (s *SerialTcp) Close() error {
+	if s.con == nil {
+		return nil
+	}
+	err := s.con.Close()
+	s.con = nil
+	return err
+}
+
+// Reconnect closes the connection and dials again.
+func (s *SerialTcp) Reconnect() error {
+	s.Close()
+	return s.Connect()
+}
+
+func (s *SerialTcp) Is_connect() bool {
+	return s.con != nil
+}
+
+func (s *SerialTcp) Write(buf []byte) (int, error) {
+	if s.con == nil {
+		return 0, net.ErrClosed
+	}
+	s.logData(DirWrite, buf)
+	return s.con.Write(buf)
+}
+
+// Read waits up to the configured timeout (plus transmission time of
+// estimated_byte) and reads until estimated_byte bytes are received.
+// With estimated_byte <= 0 the first received chunk is returned.
+func (s *SerialTcp) Read(buf []byte, estimated_byte int) (int, error) {
+	if s.con == nil {
+		return 0, net.ErrClosed
+	}
+	deadline := time.Now().Add(s.config_tcp.wait)
+	if estimated_byte > 0 {
+		deadline = deadline.Add(s.config_tcp.oneSymbolDuration * time.Duration(estimated_byte))
+	}
+	read_len, err := readStream(s.con, buf, estimated_byte, deadline)
+	if err != nil {
+		return read_len, err
+	}
+	s.logData(DirRead, buf[:read_len])
+	return read_len, nil
+}
+
+// tcp://host:port?timeout=500ms&connect_timeout=3s&keepalive=30s&nodelay=0&baud=9600
+func openTcpURL(u *url.URL) (InterfaceSerial, error) {
+	q := u.Query()
+	wait, err := urlDuration(q, "timeout", defaultURLTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSerialTcp(u.Host, wait)
+	if err != nil {
+		return nil, err
+	}
+	if q.Has("connect_timeout") {
+		d, err := urlDuration(q, "connect_timeout", 0)
+		if err != nil {
+			return nil, err
+		}
+		s.SetConnectTimeout(d)
+	}
+	if q.Has("keepalive") {
+		d, err := urlDuration(q, "keepalive", 0)
+		if err != nil {
+			return nil, err
+		}
+		s.SetKeepAlive(d)
+	}
+	if v := q.Get("nodelay"); v != "" {
+		nd, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("bad nodelay %q: %w", v, err)
+		}
+		s.SetNoDelay(nd)
+	}
+	baud, err := urlInt(q, "baud", 0)
+	if err != nil {
+		return nil, err
+	}
+	s.SetBaud(baud)
+	return s, nil
+}
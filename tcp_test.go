@@ -0,0 +1,113 @@
+package serialport
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// echo сервер, отвечает частями по chunk байт
+func tcpEchoServer(t *testing.T, chunk int) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				buf := make([]byte, 256)
+				for {
+					n, err := c.Read(buf)
+					if err != nil {
+						return
+					}
+					for i := 0; i < n; i += chunk {
+						end := i + chunk
+						if end > n {
+							end = n
+						}
+						c.Write(buf[i:end])
+						time.Sleep(5 * time.Millisecond)
+					}
+				}
+			}(c)
+		}
+	}()
+	return ln
+}
+
+func TestSerialTcp(t *testing.T) {
+	ln := tcpEchoServer(t, 2)
+	defer ln.Close()
+
+	s, err := NewFromURL("tcp://" + ln.Addr().String() + "?timeout=200ms&baud=9600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Is_connect() {
+		t.Error("Is_connect до Connect")
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	req := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x02}
+	if _, err := s.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := s.Read(buf, len(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], req) {
+		t.Errorf("read %X, expected %X", buf[:n], req)
+	}
+
+	if _, err := s.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+
+	if err := s.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Is_connect() {
+		t.Error("Is_connect после Reconnect")
+	}
+	s.Write(req[:1])
+	if n, err := s.Read(buf, 0); err != nil || n != 1 {
+		t.Errorf("read after reconnect %d %v", n, err)
+	}
+}
+
+func TestSerialTcpClosedByPeer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+	s, _ := NewSerialTcp(ln.Addr().String(), 500*time.Millisecond)
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	buf := make([]byte, 8)
+	if _, err := s.Read(buf, 0); err != io.EOF {
+		t.Errorf("ожидается EOF, получено %v", err)
+	}
+}
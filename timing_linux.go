@@ -0,0 +1,89 @@
+package serialport
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// spinThreshold is the tail of a precise wait that is busy-waited: the
+// wakeup latency of clock_nanosleep is tens of microseconds, of
+// time.Sleep up to a millisecond.
+const spinThreshold = 100 * time.Microsecond
+
+// sleepUntil waits until t with clock_nanosleep, then busy-waits the
+// last spinThreshold.
+func sleepUntil(t time.Time) {
+	for {
+		d := time.Until(t)
+		if d <= 0 {
+			return
+		}
+		if d <= spinThreshold {
+			break
+		}
+		ts := unix.NsecToTimespec(int64(d - spinThreshold))
+		// EINTR - повторяем с остатком
+		unix.ClockNanosleep(unix.CLOCK_MONOTONIC, 0, &ts, nil)
+	}
+	for time.Now().Before(t) {
+	}
+}
+
+// TurnaroundStats is the measured RS-485 turnaround: the time from the
+// end of transmission detected by Port.Drain to the receiver enabled,
+// post-TX delay included.
+type TurnaroundStats struct {
+	Count int
+	Last  time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+}
+
+// turnaround holds the direction switching delays and statistics.
+type turnaround struct {
+	preTx  time.Duration // от включения передатчика до первого байта
+	postTx time.Duration // от конца последнего байта до выключения передатчика
+
+	mu    sync.Mutex
+	stats TurnaroundStats
+	sum   time.Duration
+}
+
+func (t *turnaround) record(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := &t.stats
+	if st.Count == 0 || d < st.Min {
+		st.Min = d
+	}
+	if d > st.Max {
+		st.Max = d
+	}
+	st.Count++
+	st.Last = d
+	t.sum += d
+	st.Mean = t.sum / time.Duration(st.Count)
+}
+
+// SetTurnaround sets the RS-485 direction switching delays: preTx after
+// the driver is enabled before the first byte, postTx after the last
+// byte has left the transmitter (see Port.Drain) before the driver is
+// disabled. The delays are timed with clock_nanosleep and a busy-wait
+// tail. They are the only delays of the direction switching, the
+// ICtrlTxRxEn implementations of the package add none.
+func (s *SerialPort) SetTurnaround(preTx, postTx time.Duration) {
+	s.acquire()
+	defer s.bus.unlock()
+	s.turnaround.preTx = preTx
+	s.turnaround.postTx = postTx
+}
+
+// TurnaroundStats returns the turnaround measured by RS-485 writes.
+func (s *SerialPort) TurnaroundStats() TurnaroundStats {
+	s.turnaround.mu.Lock()
+	defer s.turnaround.mu.Unlock()
+	return s.turnaround.stats
+}
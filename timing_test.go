@@ -0,0 +1,143 @@
+package serialport
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSleepUntil(t *testing.T) {
+	for _, d := range []time.Duration{0, 50 * time.Microsecond, 300 * time.Microsecond, 2 * time.Millisecond} {
+		at := time.Now().Add(d)
+		sleepUntil(at)
+		late := time.Since(at)
+		if late < 0 {
+			t.Errorf("%v: проснулись раньше на %v", d, -late)
+		}
+		// запас на загруженную машину
+		if late > 5*time.Millisecond {
+			t.Errorf("%v: опоздание %v", d, late)
+		}
+	}
+}
+
+type recordCtrl struct {
+	calls []string
+	at    []time.Time
+	fail  map[string]error // ошибка вызова по имени, например "tx+"
+}
+
+func (c *recordCtrl) TxEn(v bool) error {
+	return c.call(map[bool]string{true: "tx+", false: "tx-"}[v])
+}
+
+func (c *recordCtrl) RxEn(v bool) error {
+	return c.call(map[bool]string{true: "rx+", false: "rx-"}[v])
+}
+
+func (c *recordCtrl) call(name string) error {
+	c.calls = append(c.calls, name)
+	c.at = append(c.at, time.Now())
+	return c.fail[name]
+}
+
+func TestTurnaround(t *testing.T) {
+	master, err := NewSerialPortPty(30 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+
+	ctrl := &recordCtrl{}
+	s, _ := NewSerialPortStty(master.PtyName(), 9600, 30*time.Millisecond, 485, ctrl)
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.SetTurnaround(time.Millisecond, 500*time.Microsecond)
+
+	start := time.Now()
+	if _, err := s.Write([]byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ctrl.calls) != 4 || ctrl.calls[0] != "tx+" || ctrl.calls[3] != "rx-" {
+		t.Fatal("последовательность управления", ctrl.calls)
+	}
+	// 4 символа при 9600 - 4,17 мс, плюс задержки
+	if d := ctrl.at[2].Sub(start); d < 5*time.Millisecond {
+		t.Error("передатчик выключен раньше конца передачи:", d)
+	}
+	st := s.TurnaroundStats()
+	if st.Count != 1 || st.Last < 500*time.Microsecond || st.Min != st.Last || st.Max != st.Last || st.Mean != st.Last {
+		t.Errorf("статистика %+v", st)
+	}
+	s.Write([]byte{5})
+	if st := s.TurnaroundStats(); st.Count != 2 || st.Min > st.Max {
+		t.Errorf("статистика %+v", st)
+	}
+}
+
+func TestTransmitCtrlError(t *testing.T) {
+	master, err := NewSerialPortPty(30 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+
+	ctrl := &recordCtrl{fail: map[string]error{"tx+": syscall.EBUSY}}
+	s, _ := NewSerialPortStty(master.PtyName(), 9600, 30*time.Millisecond, 485, ctrl)
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	buf := make([]byte, 8)
+	if _, err := s.Write([]byte{1}); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("ожидается EBUSY, получено %v", err)
+	}
+	if n, err := master.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("кадр ушел с выключенным передатчиком: %X %v", buf[:n], err)
+	}
+
+	ctrl.fail = map[string]error{"rx-": os.ErrClosed}
+	ctrl.calls = nil
+	if _, err := s.Write([]byte{2}); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("ожидается ошибка выключения, получено %v", err)
+	}
+	if len(ctrl.calls) != 4 || ctrl.calls[2] != "tx-" {
+		t.Error("последовательность управления", ctrl.calls)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	master, err := NewSerialPortPty(30 * time.Millisecond)
+	if err == nil {
+		err = master.Connect()
+	}
+	if err != nil {
+		t.Skip("pty недоступен:", err)
+	}
+	defer master.Close()
+	p, err := OpenPort(&Config{Name: master.PtyName(), Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Write([]byte{1, 2, 3})
+	estimate := p.txEnd
+	end, err := p.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pty без TIOCSERGETLSR - через tcdrain
+	if !p.noLsr || end.Before(estimate) || time.Since(end) > 50*time.Millisecond {
+		t.Errorf("конец передачи %v, оценка %v, noLsr %v", end, estimate, p.noLsr)
+	}
+}
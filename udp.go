@@ -0,0 +1,199 @@
+package serialport
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// UdpReadMode selects how SerialPort.Read assembles UDP datagrams.
+type UdpReadMode int
+
+const (
+	// UdpReadDatagram returns one datagram per Read. A datagram longer
+	// than the buffer is returned in parts by the following Reads.
+	UdpReadDatagram UdpReadMode = iota
+	// UdpReadConcat appends datagrams from the same sender until
+	// estimated_byte bytes are received or no datagram arrives within the gap.
+	UdpReadConcat
+)
+
+// SetUdpReadMode sets the datagram assembly of Read. gap is the wait for
+// the next datagram in UdpReadConcat mode; if 0, the read timeout is used.
+func (s *SerialPort) SetUdpReadMode(mode UdpReadMode, gap time.Duration) {
+	s.udp_read_mode = mode
+	s.udp_read_gap = gap
+}
+
+// SetUdpAnyPeer disables filtering of received datagrams by the
+// destination address. By default datagrams from other senders are
+// dropped, except in broadcast and multicast mode.
+func (s *SerialPort) SetUdpAnyPeer(any bool) {
+	s.udp_any_peer = any
+}
+
+// SetUdpBroadcast allows sending to a broadcast destination such as
+// 192.168.1.255. It is enabled automatically for 255.255.255.255.
+// Takes effect on next Connect.
+func (s *SerialPort) SetUdpBroadcast(enable bool) {
+	s.udp_broadcast = enable
+}
+
+// SetUdpMulticast sets the options used when the destination host is a
+// multicast group: the interface to join and send on ("" - system
+// default), TTL (0 - default 1) and whether own datagrams are looped
+// back. Takes effect on next Connect.
+func (s *SerialPort) SetUdpMulticast(ifname string, ttl int, loopback bool) {
+	s.udp_multicast.ifname = ifname
+	s.udp_multicast.ttl = ttl
+	s.udp_multicast.loopback = loopback
+}
+
+// LastPeer returns the sender of the data returned by the last Read.
+func (s *SerialPort) LastPeer() *net.UDPAddr {
+	s.acquire()
+	defer s.bus.unlock()
+	return s.udp_last_peer
+}
+
+// WriteToPeer sends buf to addr instead of the destination, e.g. to the
+// converter that answered a broadcast.
+func (s *SerialPort) WriteToPeer(buf []byte, addr *net.UDPAddr) (int, error) {
+	s.acquire()
+	defer s.bus.unlock()
+	return s.writeToPeer(buf, addr)
+}
+
+func (s *SerialPort) writeToPeer(buf []byte, addr *net.UDPAddr) (int, error) {
+	if s.type_serial != type_serial_udp {
+		return 0, &ConfigError{Field: "type_serial", Value: s.type_serial, Err: ErrBadTransport}
+	}
+	if s.udp_con == nil {
+		return 0, net.ErrClosed
+	}
+	s.logData(DirWrite, buf, slog.String("peer", addr.String()))
+	return s.udp_con.WriteToUDP(buf, addr)
+}
+
+func (s *SerialPort) udpGroupMode() bool {
+	dest := s.udp_dest_addr
+	if dest == nil {
+		return false
+	}
+	return s.udp_broadcast || dest.IP.Equal(net.IPv4bcast) || dest.IP.IsMulticast()
+}
+
+func (s *SerialPort) listenUdp() (*net.UDPConn, error) {
+	dest := s.udp_dest_addr
+	if dest != nil && dest.IP.IsMulticast() {
+		var ifi *net.Interface
+		if s.udp_multicast.ifname != "" {
+			var err error
+			if ifi, err = net.InterfaceByName(s.udp_multicast.ifname); err != nil {
+				return nil, err
+			}
+		}
+		group := &net.UDPAddr{IP: dest.IP, Port: int(s.config_udp.listen_port)}
+		network := "udp4"
+		if dest.IP.To4() == nil {
+			network = "udp6"
+		}
+		con, err := net.ListenMulticastUDP(network, ifi, group)
+		if err != nil {
+			return nil, err
+		}
+		m := s.udp_multicast
+		if err := udpSetMulticast(con, network == "udp6", ifi, m.ttl, m.loopback); err != nil {
+			con.Close()
+			return nil, err
+		}
+		return con, nil
+	}
+	con, err := net.ListenUDP("udp", s.udp_listen_addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.udp_broadcast || (dest != nil && dest.IP.Equal(net.IPv4bcast)) {
+		if err := udpSetBroadcast(con); err != nil {
+			con.Close()
+			return nil, err
+		}
+	}
+	return con, nil
+}
+
+func (s *SerialPort) udpPeerAllowed(addr *net.UDPAddr) bool {
+	if s.udp_any_peer || s.udp_dest_addr == nil || s.udp_dest_addr.IP.IsUnspecified() || s.udpGroupMode() {
+		return true
+	}
+	return addr.Port == s.udp_dest_addr.Port && addr.IP.Equal(s.udp_dest_addr.IP)
+}
+
+func sameUDPAddr(a, b *net.UDPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+func (s *SerialPort) readUdp(buf []byte, estimated_byte int, wait time.Duration) (int, error) {
+	if s.udp_con == nil {
+		return 0, net.ErrClosed
+	}
+	if s.udp_buf == nil {
+		s.udp_buf = make([]byte, 65536)
+	}
+	deadline := time.Now().Add(wait)
+	read_len := 0
+	var peer *net.UDPAddr
+	for read_len < len(buf) {
+		var data []byte
+		var addr *net.UDPAddr
+		if s.udp_pending != nil {
+			data, addr = s.udp_pending, s.udp_pending_addr
+			s.udp_pending, s.udp_pending_addr = nil, nil
+		} else {
+			s.udp_con.SetReadDeadline(deadline)
+			n, from, err := s.udp_con.ReadFromUDP(s.udp_buf)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					if read_len == 0 {
+						return 0, ErrTimeout
+					}
+					break
+				}
+				return read_len, err
+			}
+			if !s.udpPeerAllowed(from) {
+				s.logEvent("drop datagram", slog.String("peer", from.String()), slog.Int("len", n))
+				continue
+			}
+			data, addr = s.udp_buf[:n], from
+		}
+		if peer != nil && !sameUDPAddr(peer, addr) {
+			// ответ другого устройства, вернем следующим Read
+			s.udp_pending = append([]byte(nil), data...)
+			s.udp_pending_addr = addr
+			break
+		}
+		peer = addr
+		n := copy(buf[read_len:], data)
+		s.logData(DirRead, buf[read_len:read_len+n], slog.String("peer", addr.String()))
+		read_len += n
+		if n < len(data) {
+			// датаграмма не поместилась в buf, остаток вернем следующим Read
+			s.udp_pending = append([]byte(nil), data[n:]...)
+			s.udp_pending_addr = addr
+			break
+		}
+		if s.udp_read_mode != UdpReadConcat || (estimated_byte > 0 && read_len >= estimated_byte) {
+			break
+		}
+		gap := s.udp_read_gap
+		if gap <= 0 {
+			gap = s.config_udp.wait
+		}
+		deadline = time.Now().Add(gap)
+	}
+	s.udp_last_peer = peer
+	return read_len, nil
+}
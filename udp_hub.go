@@ -0,0 +1,308 @@
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	udpHubQueue = 32
+
+	// пауза после ошибки сокета, удваивается до udpHubMaxBackoff
+	udpHubMinBackoff = time.Millisecond
+	udpHubMaxBackoff = 100 * time.Millisecond
+)
+
+// udpReceiver is the receiving side of a *net.UDPConn.
+type udpReceiver interface {
+	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
+}
+
+// UdpHub owns one UDP socket shared by many remote converters and hands
+// out a transport per peer, demultiplexed by source address and port.
+type UdpHub struct {
+	dataLogger
+	listen_addr *net.UDPAddr
+
+	mu      sync.Mutex
+	con     *net.UDPConn
+	peers   map[netip.AddrPort]*UdpHubPeer
+	unknown func(addr *net.UDPAddr, data []byte) bool
+	wg      sync.WaitGroup
+}
+
+// UdpHubPeer is the transport of one peer of a UdpHub. Read returns one
+// datagram per call.
+type UdpHubPeer struct {
+	dataLogger
+	hub  *UdpHub
+	addr netip.AddrPort
+	wait time.Duration
+
+	mu      sync.Mutex
+	open    bool
+	queue   chan []byte
+	dropped int
+}
+
+// NewUdpHub creates a hub listening on listen_port of all interfaces.
+func NewUdpHub(listen_port uint16) (*UdpHub, error) {
+	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", listen_port))
+	if err != nil {
+		return nil, err
+	}
+	h := &UdpHub{listen_addr: addr, peers: map[netip.AddrPort]*UdpHubPeer{}}
+	h.log_port = addr.String()
+	return h, nil
+}
+
+// OnUnknownPeer sets a callback for datagrams from senders without an
+// endpoint. If it returns true, the datagram is delivered to the
+// endpoint of the sender, which is created with a 1s read timeout
+// unless the callback created it with Peer.
+func (h *UdpHub) OnUnknownPeer(f func(addr *net.UDPAddr, data []byte) bool) {
+	h.mu.Lock()
+	h.unknown = f
+	h.mu.Unlock()
+}
+
+// Connect opens the socket and starts dispatching. It does nothing if
+// the hub is already connected.
+func (h *UdpHub) Connect() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.con != nil {
+		return nil
+	}
+	con, err := net.ListenUDP("udp", h.listen_addr)
+	if err != nil {
+		return err
+	}
+	h.con = con
+	h.wg.Add(1)
+	go h.recv(con)
+	return nil
+}
+
+// Close closes the socket. Peer endpoints stay registered and can be
+// used again after the next Connect.
+func (h *UdpHub) Close() error {
+	h.mu.Lock()
+	con := h.con
+	h.con = nil
+	h.mu.Unlock()
+	if con == nil {
+		return nil
+	}
+	err := con.Close()
+	h.wg.Wait()
+	return err
+}
+
+// LocalAddr returns the address of the hub socket, nil if not connected.
+func (h *UdpHub) LocalAddr() *net.UDPAddr {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.con == nil {
+		return nil
+	}
+	return h.con.LocalAddr().(*net.UDPAddr)
+}
+
+func udpAddrPort(addr *net.UDPAddr) netip.AddrPort {
+	ap := addr.AddrPort()
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// Peer returns the endpoint for host:port, creating it if needed.
+// wait is the read timeout of a new endpoint.
+func (h *UdpHub) Peer(host string, port uint16, wait time.Duration) (*UdpHubPeer, error) {
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.peer(udpAddrPort(addr), wait), nil
+}
+
+func (h *UdpHub) peer(ap netip.AddrPort, wait time.Duration) *UdpHubPeer {
+	if p, ok := h.peers[ap]; ok {
+		return p
+	}
+	p := &UdpHubPeer{hub: h, addr: ap, wait: wait, queue: make(chan []byte, udpHubQueue)}
+	p.log_port = ap.String()
+	p.log_config = h.log_config // по умолчанию логирование как у хаба
+	h.peers[ap] = p
+	return p
+}
+
+// RemovePeer closes and forgets the endpoint.
+func (h *UdpHub) RemovePeer(p *UdpHubPeer) {
+	p.Close()
+	h.mu.Lock()
+	if h.peers[p.addr] == p {
+		delete(h.peers, p.addr)
+	}
+	h.mu.Unlock()
+}
+
+// Peers returns the registered endpoints.
+func (h *UdpHub) Peers() []*UdpHubPeer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	peers := make([]*UdpHubPeer, 0, len(h.peers))
+	for _, p := range h.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// recv dispatches datagrams until the socket is closed. After a socket
+// error it backs off, so that a persistent error does not spin.
+func (h *UdpHub) recv(con udpReceiver) {
+	defer h.wg.Done()
+	buf := make([]byte, 65536)
+	var backoff time.Duration
+	for {
+		n, addr, err := con.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if backoff == 0 {
+				h.logEvent("receive", slog.Any("err", err))
+				backoff = udpHubMinBackoff
+			} else if backoff *= 2; backoff > udpHubMaxBackoff {
+				backoff = udpHubMaxBackoff
+			}
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+		data := append([]byte(nil), buf[:n]...)
+		ap := udpAddrPort(addr)
+
+		h.mu.Lock()
+		p, ok := h.peers[ap]
+		unknown := h.unknown
+		h.mu.Unlock()
+		if !ok {
+			if unknown == nil || !unknown(addr, data) {
+				h.logEvent("drop datagram", slog.String("peer", addr.String()), slog.Int("len", n))
+				continue
+			}
+			h.mu.Lock()
+			p = h.peer(ap, time.Second)
+			h.mu.Unlock()
+			p.mu.Lock()
+			p.open = true
+			p.mu.Unlock()
+		}
+		p.deliver(data)
+	}
+}
+
+func (p *UdpHubPeer) deliver(data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.open {
+		return
+	}
+	for {
+		select {
+		case p.queue <- data:
+			return
+		default:
+			// очередь полна, вытесняем самую старую датаграмму
+			select {
+			case <-p.queue:
+				p.dropped++
+			default:
+			}
+		}
+	}
+}
+
+// Addr returns the peer address.
+func (p *UdpHubPeer) Addr() *net.UDPAddr {
+	return net.UDPAddrFromAddrPort(p.addr)
+}
+
+// Dropped returns the number of datagrams discarded because the queue was full.
+func (p *UdpHubPeer) Dropped() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// Connect connects the hub if needed and starts queueing datagrams
+// from the peer.
+func (p *UdpHubPeer) Connect() error {
+	if err := p.hub.Connect(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.open = true
+	p.mu.Unlock()
+	return nil
+}
+
+// Close stops queueing and discards queued datagrams. The hub socket
+// stays open.
+func (p *UdpHubPeer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.open = false
+	for {
+		select {
+		case <-p.queue:
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *UdpHubPeer) Reconnect() error {
+	p.Close()
+	return p.Connect()
+}
+
+func (p *UdpHubPeer) Is_connect() bool {
+	p.mu.Lock()
+	open := p.open
+	p.mu.Unlock()
+	return open && p.hub.LocalAddr() != nil
+}
+
+func (p *UdpHubPeer) Write(buf []byte) (int, error) {
+	p.hub.mu.Lock()
+	con := p.hub.con
+	p.hub.mu.Unlock()
+	if con == nil || !p.Is_connect() {
+		return 0, net.ErrClosed
+	}
+	p.logData(DirWrite, buf)
+	return con.WriteToUDPAddrPort(buf, p.addr)
+}
+
+// Read returns the next datagram from the peer, waiting up to the read
+// timeout. estimated_byte is ignored.
+func (p *UdpHubPeer) Read(buf []byte, estimated_byte int) (int, error) {
+	if !p.Is_connect() {
+		return 0, net.ErrClosed
+	}
+	select {
+	case data := <-p.queue:
+		n := copy(buf, data)
+		p.logData(DirRead, buf[:n])
+		return n, nil
+	case <-time.After(p.wait):
+		return 0, ErrTimeout
+	}
+}
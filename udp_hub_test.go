@@ -0,0 +1,125 @@
+package serialport
+
+import (
+	"bytes"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUdpHub(t *testing.T) {
+	hub, err := NewUdpHub(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
+	hubAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: hub.LocalAddr().Port}
+
+	dev1, other := udpPeers(t)
+	dev2, _ := udpPeers(t)
+	p1, _ := hub.Peer("127.0.0.1", uint16(dev1.LocalAddr().(*net.UDPAddr).Port), 100*time.Millisecond)
+	p2, _ := hub.Peer("127.0.0.1", uint16(dev2.LocalAddr().(*net.UDPAddr).Port), 100*time.Millisecond)
+	for _, p := range []*UdpHubPeer{p1, p2} {
+		if err := p.Connect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	discovered := make(chan *net.UDPAddr, 1)
+	hub.OnUnknownPeer(func(addr *net.UDPAddr, data []byte) bool {
+		discovered <- addr
+		return bytes.Equal(data, []byte("hello"))
+	})
+
+	dev2.WriteToUDP([]byte{0x02}, hubAddr)
+	dev1.WriteToUDP([]byte{0x01}, hubAddr)
+	buf := make([]byte, 16)
+	if n, err := p1.Read(buf, 0); err != nil || !bytes.Equal(buf[:n], []byte{0x01}) {
+		t.Errorf("p1 read %X %v", buf[:n], err)
+	}
+	if n, err := p2.Read(buf, 0); err != nil || !bytes.Equal(buf[:n], []byte{0x02}) {
+		t.Errorf("p2 read %X %v", buf[:n], err)
+	}
+	if _, err := p1.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+
+	p1.Write([]byte{0x11})
+	if n, _, err := dev1.ReadFromUDP(buf); err != nil || !bytes.Equal(buf[:n], []byte{0x11}) {
+		t.Errorf("dev1 получил %X %v", buf[:n], err)
+	}
+
+	other.WriteToUDP([]byte("hello"), hubAddr)
+	select {
+	case addr := <-discovered:
+		if addr.Port != other.LocalAddr().(*net.UDPAddr).Port {
+			t.Errorf("discovered %s", addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("нет вызова OnUnknownPeer")
+	}
+	p3, _ := hub.Peer("127.0.0.1", uint16(other.LocalAddr().(*net.UDPAddr).Port), 100*time.Millisecond)
+	if n, err := p3.Read(buf, 0); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("p3 read %q %v", buf[:n], err)
+	}
+	if len(hub.Peers()) != 3 {
+		t.Errorf("peers %d", len(hub.Peers()))
+	}
+
+	hub.RemovePeer(p3)
+	if p3.Is_connect() || len(hub.Peers()) != 2 {
+		t.Error("RemovePeer")
+	}
+}
+
+func TestUdpHubPeerQueueOverflow(t *testing.T) {
+	hub, _ := NewUdpHub(0)
+	p, _ := hub.Peer("127.0.0.1", 1, 10*time.Millisecond)
+	p.open = true
+	for i := 0; i < udpHubQueue+5; i++ {
+		p.deliver([]byte{byte(i)})
+	}
+	if p.Dropped() != 5 {
+		t.Errorf("dropped %d", p.Dropped())
+	}
+	if d := <-p.queue; d[0] != 5 {
+		t.Errorf("первая датаграмма %d", d[0])
+	}
+}
+
+// failingReceiver returns err until stop is closed, then net.ErrClosed.
+type failingReceiver struct {
+	err   error
+	stop  chan struct{}
+	calls int
+}
+
+func (f *failingReceiver) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	select {
+	case <-f.stop:
+		return 0, nil, net.ErrClosed
+	default:
+	}
+	f.calls++
+	return 0, nil, f.err
+}
+
+func TestUdpHubRecvBackoff(t *testing.T) {
+	hub, err := NewUdpHub(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &failingReceiver{err: syscall.ENOBUFS, stop: make(chan struct{})}
+	hub.wg.Add(1)
+	go hub.recv(f)
+	time.Sleep(100 * time.Millisecond)
+	close(f.stop)
+	hub.wg.Wait()
+	if f.calls > 20 {
+		t.Errorf("%d вызовов за 100мс, ожидается пауза после ошибки", f.calls)
+	}
+}
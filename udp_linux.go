@@ -0,0 +1,60 @@
+package serialport
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+func udpSetsockopt(con *net.UDPConn, set func(fd int) error) error {
+	rc, err := con.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) { serr = set(int(fd)) }); err != nil {
+		return err
+	}
+	return serr
+}
+
+func udpSetBroadcast(con *net.UDPConn) error {
+	return udpSetsockopt(con, func(fd int) error {
+		return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BROADCAST, 1)
+	})
+}
+
+// udpSetMulticast sets the outgoing interface, TTL (hop limit) and
+// loopback of multicast datagrams.
+func udpSetMulticast(con *net.UDPConn, ipv6 bool, ifi *net.Interface, ttl int, loopback bool) error {
+	loop := 0
+	if loopback {
+		loop = 1
+	}
+	return udpSetsockopt(con, func(fd int) error {
+		if ipv6 {
+			if ifi != nil {
+				if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_IF, ifi.Index); err != nil {
+					return err
+				}
+			}
+			if ttl > 0 {
+				if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_HOPS, ttl); err != nil {
+					return err
+				}
+			}
+			return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_LOOP, loop)
+		}
+		if ifi != nil {
+			if err := unix.SetsockoptIPMreqn(fd, unix.IPPROTO_IP, unix.IP_MULTICAST_IF, &unix.IPMreqn{Ifindex: int32(ifi.Index)}); err != nil {
+				return err
+			}
+		}
+		if ttl > 0 {
+			if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MULTICAST_TTL, ttl); err != nil {
+				return err
+			}
+		}
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MULTICAST_LOOP, loop)
+	})
+}
@@ -0,0 +1,216 @@
+package serialport
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// удаленный конвертер и посторонний отправитель
+func udpPeers(t *testing.T) (*net.UDPConn, *net.UDPConn) {
+	t.Helper()
+	dev, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dev.Close() })
+	other, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+	return dev, other
+}
+
+func newUdpSerial(t *testing.T, dev *net.UDPConn) (*SerialPort, *net.UDPAddr) {
+	t.Helper()
+	s, err := NewSerialPortUdp("127.0.0.1", 0, uint16(dev.LocalAddr().(*net.UDPAddr).Port), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Is_connect() {
+		t.Error("Is_connect до Connect")
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if !s.Is_connect() {
+		t.Error("Is_connect после Connect")
+	}
+	local := s.udp_con.LocalAddr().(*net.UDPAddr)
+	return s, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: local.Port}
+}
+
+func TestSerialPortUdpDatagram(t *testing.T) {
+	dev, other := udpPeers(t)
+	s, addr := newUdpSerial(t, dev)
+
+	if _, err := s.Write([]byte{0x01, 0x02}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, _, err := dev.ReadFromUDP(buf)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x01, 0x02}) {
+		t.Errorf("конвертер получил %X %v", buf[:n], err)
+	}
+
+	other.WriteToUDP([]byte{0xEE}, addr)
+	dev.WriteToUDP([]byte{0x0A, 0x0B}, addr)
+	dev.WriteToUDP([]byte{0x0C}, addr)
+	n, err = s.Read(buf, 0)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x0A, 0x0B}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	n, err = s.Read(buf, 0)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x0C}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	// датаграмма длиннее буфера читается по частям
+	dev.WriteToUDP([]byte{1, 2, 3, 4, 5}, addr)
+	for _, want := range [][]byte{{1, 2}, {3, 4}, {5}} {
+		n, err = s.Read(buf[:2], 0)
+		if err != nil || !bytes.Equal(buf[:n], want) {
+			t.Errorf("read %X %v, ожидалось %X", buf[:n], err, want)
+		}
+	}
+	if _, err := s.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+
+	s.Close()
+	if s.Is_connect() {
+		t.Error("Is_connect после Close")
+	}
+	if err := s.Close(); err != nil {
+		t.Error("повторный Close", err)
+	}
+}
+
+func TestSerialPortUdpConcat(t *testing.T) {
+	dev, other := udpPeers(t)
+	s, addr := newUdpSerial(t, dev)
+	s.SetUdpReadMode(UdpReadConcat, 30*time.Millisecond)
+
+	dev.WriteToUDP([]byte{0x01, 0x02}, addr)
+	dev.WriteToUDP([]byte{0x03}, addr)
+	dev.WriteToUDP([]byte{0x04}, addr)
+	buf := make([]byte, 16)
+	n, err := s.Read(buf, 3)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x01, 0x02, 0x03}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	n, err = s.Read(buf, 3)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x04}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+
+	s.SetUdpAnyPeer(true)
+	other.WriteToUDP([]byte{0xEE}, addr)
+	n, err = s.Read(buf, 0)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0xEE}) {
+		t.Errorf("read any peer %X %v", buf[:n], err)
+	}
+}
+
+func TestSerialPortUdpBroadcast(t *testing.T) {
+	// broadcast не доставляется сокетам, привязанным к 127.0.0.1
+	dev1, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev1.Close()
+	_, dev2 := udpPeers(t)
+	port := dev1.LocalAddr().(*net.UDPAddr).Port
+	dev1Addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+	s, err := NewSerialPortUdp("127.255.255.255", 0, uint16(port), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetUdpBroadcast(true)
+	s.SetUdpReadMode(UdpReadConcat, 30*time.Millisecond)
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	local := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: s.udp_con.LocalAddr().(*net.UDPAddr).Port}
+
+	if _, err := s.Write([]byte{0x55}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	dev1.SetReadDeadline(time.Now().Add(time.Second))
+	if n, _, err := dev1.ReadFromUDP(buf); err != nil || !bytes.Equal(buf[:n], []byte{0x55}) {
+		t.Fatalf("broadcast не получен %X %v", buf[:n], err)
+	}
+
+	dev1.WriteToUDP([]byte{0x01}, local)
+	time.Sleep(10 * time.Millisecond)
+	dev2.WriteToUDP([]byte{0x02}, local)
+	n, err := s.Read(buf, 2)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x01}) || !sameUDPAddr(s.LastPeer(), dev1Addr) {
+		t.Errorf("read %X %v from %s", buf[:n], err, s.LastPeer())
+	}
+	n, err = s.Read(buf, 2)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x02}) || !sameUDPAddr(s.LastPeer(), dev2.LocalAddr().(*net.UDPAddr)) {
+		t.Errorf("read %X %v from %s", buf[:n], err, s.LastPeer())
+	}
+
+	if _, err := s.WriteToPeer([]byte{0x66}, dev2.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	dev2.SetReadDeadline(time.Now().Add(time.Second))
+	if n, _, err := dev2.ReadFromUDP(buf); err != nil || !bytes.Equal(buf[:n], []byte{0x66}) {
+		t.Errorf("dev2 получил %X %v", buf[:n], err)
+	}
+}
+
+func TestSerialPortUdpMulticast(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("нет интерфейса lo:", err)
+	}
+	dev, err := net.ListenMulticastUDP("udp4", lo, &net.UDPAddr{IP: net.IPv4(239, 1, 2, 3)})
+	if err != nil {
+		t.Skip("multicast недоступен:", err)
+	}
+	defer dev.Close()
+	udpSetMulticast(dev, false, lo, 1, true)
+	port := dev.LocalAddr().(*net.UDPAddr).Port
+
+	s, err := NewSerialPortUdp("239.1.2.3", uint16(port), uint16(port), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetUdpMulticast("lo", 1, true)
+	if err := s.Connect(); err != nil {
+		t.Skip("multicast недоступен:", err)
+	}
+	defer s.Close()
+
+	if _, err := s.Write([]byte{0x77}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	dev.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := dev.ReadFromUDP(buf)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x77}) {
+		t.Fatalf("устройство получило %X %v", buf[:n], err)
+	}
+
+	// ответ в группу, с loopback его получит и сам отправитель
+	dev.WriteToUDP([]byte{0x78}, &net.UDPAddr{IP: net.IPv4(239, 1, 2, 3), Port: port})
+	for {
+		n, err := s.Read(buf, 0)
+		if err != nil {
+			t.Fatalf("ответ не получен: %v", err)
+		}
+		if bytes.Equal(buf[:n], []byte{0x78}) {
+			if s.LastPeer() == nil || s.LastPeer().Port != port {
+				t.Errorf("peer %s", s.LastPeer())
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNoPeer is returned by a listening transport before a peer connects.
+var ErrNoPeer = errors.New("no peer connected")
+
+// SerialUnix is a transport over a Unix stream socket, e.g. the serial
+// port of a QEMU or Renode virtual machine. In listener mode the peer
+// connects to us; a new peer replaces the previous one.
+type SerialUnix struct {
+	dataLogger
+	path   string
+	wait   time.Duration
+	listen bool
+
+	mu        sync.Mutex
+	con       net.Conn
+	ln        *net.UnixListener
+	connected chan struct{} // закрывается при подключении пира
+	wg        sync.WaitGroup
+}
+
+func init() {
+	RegisterScheme("unix", openUnixURL)
+}
+
+// NewSerialUnix creates a client of the socket at path.
+func NewSerialUnix(path string, wait time.Duration) (*SerialUnix, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unix socket: empty path")
+	}
+	s := &SerialUnix{path: path, wait: wait}
+	s.log_port = path
+	return s, nil
+}
+
+// NewSerialUnixListener creates a transport that listens on path and
+// talks to the peer that connects to it.
+func NewSerialUnixListener(path string, wait time.Duration) (*SerialUnix, error) {
+	s, err := NewSerialUnix(path, wait)
+	if err != nil {
+		return nil, err
+	}
+	s.listen = true
+	return s, nil
+}
+
+// Connect dials the socket, or in listener mode creates it (removing a
+// stale socket file) and starts accepting peers.
+func (s *SerialUnix) Connect() error {
+	s.Close()
+	if !s.listen {
+		con, err := net.DialTimeout("unix", s.path, s.wait)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.con = con
+		s.mu.Unlock()
+		return nil
+	}
+	if fi, err := os.Lstat(s.path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(s.path)
+	}
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: s.path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	ln.SetUnlinkOnClose(true)
+	s.mu.Lock()
+	s.ln = ln
+	s.connected = make(chan struct{})
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go s.accept(ln)
+	return nil
+}
+
+func (s *SerialUnix) accept(ln *net.UnixListener) {
+	defer s.wg.Done()
+	for {
+		con, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.ln != ln {
+			// Close уже выполнен, соединение опоздало
+			s.mu.Unlock()
+			con.Close()
+			return
+		}
+		if s.con != nil {
+			s.con.Close()
+		}
+		s.con = con
+		select {
+		case <-s.connected:
+		default:
+			close(s.connected)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *SerialUnix) Close() error {
+	s.mu.Lock()
+	con, ln := s.con, s.ln
+	s.con, s.ln = nil, nil
+	s.mu.Unlock()
+	var err error
+	if ln != nil {
+		err = ln.Close()
+		s.wg.Wait()
+	}
+	if con != nil {
+		if cerr := con.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *SerialUnix) Reconnect() error {
+	s.Close()
+	return s.Connect()
+}
+
+// Is_connect reports whether the socket is connected, in listener mode
+// whether it is listening.
+func (s *SerialUnix) Is_connect() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.con != nil || s.ln != nil
+}
+
+// peer returns the current connection, in listener mode waiting up to
+// the read timeout for a peer.
+func (s *SerialUnix) peer(wait bool) (net.Conn, error) {
+	s.mu.Lock()
+	con, ln, connected := s.con, s.ln, s.connected
+	s.mu.Unlock()
+	if con != nil {
+		return con, nil
+	}
+	if ln == nil {
+		return nil, net.ErrClosed
+	}
+	if !wait {
+		return nil, ErrNoPeer
+	}
+	select {
+	case <-connected:
+		return s.peer(false)
+	case <-time.After(s.wait):
+		return nil, ErrTimeout
+	}
+}
+
+func (s *SerialUnix) Write(buf []byte) (int, error) {
+	con, err := s.peer(false)
+	if err != nil {
+		return 0, err
+	}
+	s.logData(DirWrite, buf)
+	return con.Write(buf)
+}
+
+// Read waits up to the read timeout and reads until estimated_byte bytes
+// are received. With estimated_byte <= 0 the first received chunk is returned.
+//
+// Unlike SerialPort, Read does not sleep for the estimated character time
+// and does not return after a single read: a socket has no line timing and
+// a frame may arrive in several chunks, so Read collects them until
+// estimated_byte bytes are received or the timeout expires.
+func (s *SerialUnix) Read(buf []byte, estimated_byte int) (int, error) {
+	deadline := time.Now().Add(s.wait)
+	con, err := s.peer(true)
+	if err != nil {
+		return 0, err
+	}
+	n, err := readStream(con, buf, estimated_byte, deadline)
+	if err != nil {
+		return n, err
+	}
+	s.logData(DirRead, buf[:n])
+	return n, nil
+}
+
+// unix:///tmp/vm.sock?timeout=500ms&listen=1
+func openUnixURL(u *url.URL) (InterfaceSerial, error) {
+	q := u.Query()
+	wait, err := urlDuration(q, "timeout", defaultURLTimeout)
+	if err != nil {
+		return nil, err
+	}
+	path := u.Path
+	if path == "" {
+		path = u.Opaque
+	}
+	switch q.Get("listen") {
+	case "", "0", "false":
+		return NewSerialUnix(path, wait)
+	}
+	return NewSerialUnixListener(path, wait)
+}
@@ -0,0 +1,120 @@
+package serialport
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSerialUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 64)
+		n, _ := c.Read(buf)
+		c.Write(buf[:n])
+	}()
+
+	s, err := NewFromURL("unix://" + path + "?timeout=200ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Write([]byte{0x01, 0x02, 0x03})
+	buf := make([]byte, 16)
+	n, err := s.Read(buf, 3)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x01, 0x02, 0x03}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	if _, err := s.Read(buf, 0); err == nil {
+		t.Error("ожидается ошибка после закрытия пира")
+	}
+}
+
+func TestSerialUnixListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.sock")
+	s, err := NewSerialUnixListener(path, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	buf := make([]byte, 16)
+	if _, err := s.Write([]byte{0x01}); err != ErrNoPeer {
+		t.Errorf("ожидается ErrNoPeer, получено %v", err)
+	}
+	if _, err := s.Read(buf, 0); err != ErrTimeout {
+		t.Errorf("ожидается ErrTimeout, получено %v", err)
+	}
+
+	vm, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	vm.Write([]byte{0x0A})
+	n, err := s.Read(buf, 0)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0x0A}) {
+		t.Errorf("read %X %v", buf[:n], err)
+	}
+	if _, err := s.Write([]byte{0x0B}); err != nil {
+		t.Fatal(err)
+	}
+	vm.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := vm.Read(buf); err != nil || !bytes.Equal(buf[:n], []byte{0x0B}) {
+		t.Errorf("vm получила %X %v", buf[:n], err)
+	}
+
+	// повторный Connect пересоздает сокет
+	if err := s.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Is_connect() {
+		t.Error("Is_connect после Reconnect")
+	}
+}
+
+func TestSerialUnixLateAccept(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.sock")
+	s, err := NewSerialUnixListener(path, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// accept слушателя, который Close уже снял с порта
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	vm, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	s.wg.Add(1)
+	s.accept(ln)
+	if s.Is_connect() {
+		t.Error("Is_connect после Close")
+	}
+	vm.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := vm.Read(make([]byte, 1)); err == nil {
+		t.Error("опоздавшее соединение не закрыто")
+	}
+}